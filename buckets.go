@@ -0,0 +1,86 @@
+package gin_monitor
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// nativeHistogramMaxBuckets bounds the memory used by each native histogram series,
+	// widening its buckets once exceeded
+	nativeHistogramMaxBuckets = 160
+	// nativeHistogramMinResetDuration is the least time between native histogram resets
+	nativeHistogramMinResetDuration = time.Hour
+)
+
+// newRequestDuration creates the request duration histogram with the given buckets
+func (cfg config) newRequestDuration(buckets []float64) *prometheus.HistogramVec {
+	opts := prometheus.HistogramOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "request_seconds",
+		Help:        "Duration in seconds of HTTP requests.",
+		Buckets:     buckets,
+	}
+	if cfg.nativeHistogramFactor > 0 {
+		opts.NativeHistogramBucketFactor = cfg.nativeHistogramFactor
+		opts.NativeHistogramMaxBucketNumber = nativeHistogramMaxBuckets
+		opts.NativeHistogramMinResetDuration = nativeHistogramMinResetDuration
+	}
+	return prometheus.NewHistogramVec(opts, cfg.requestLabelNames())
+}
+
+// SetRouteBuckets sets the request duration buckets of the requests recorded with the addr label value of the route.
+// It is the route template, as returned by gin.Context.FullPath, unless rewritten by WithLabelFunc, WithPathNormalization
+// or WithCatchAllCollapse, in which case the rewritten value must be given. Routes without buckets of their own use
+// the ones set by WithBuckets. Durations already observed for the route are discarded, since they do not fit the new buckets.
+// It returns an error, keeping the current buckets of the route, if the buckets are not strictly increasing.
+func (m *Monitor) SetRouteBuckets(route string, buckets []float64) error {
+	if err := validateBuckets(buckets); err != nil {
+		return fmt.Errorf("invalid buckets for route %q: %w", route, err)
+	}
+
+	m.routeDurationsMutex.Lock()
+	defer m.routeDurationsMutex.Unlock()
+
+	m.routeDurations[route] = m.newRequestDuration(buckets)
+	m.reqDuration.DeletePartialMatch(prometheus.Labels{"addr": route})
+	return nil
+}
+
+// validateBuckets checks the buckets are strictly increasing, since prometheus only panics on them once a series is observed
+func validateBuckets(buckets []float64) error {
+	for i, bound := range buckets {
+		if math.IsNaN(bound) {
+			return fmt.Errorf("bucket %d is NaN", i)
+		}
+		if i > 0 && bound <= buckets[i-1] {
+			return fmt.Errorf("buckets must be in strictly increasing order, got %v after %v", bound, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// requestDurationCollector collects the default request duration histogram along with the per-route ones.
+// They all share the same descriptor, so each addr label value is only ever observed by one of them.
+type requestDurationCollector struct {
+	m *Monitor
+}
+
+func (c *requestDurationCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.m.reqDuration.Describe(ch)
+}
+
+func (c *requestDurationCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.routeDurationsMutex.RLock()
+	defer c.m.routeDurationsMutex.RUnlock()
+
+	c.m.reqDuration.Collect(ch)
+	for _, histogram := range c.m.routeDurations {
+		histogram.Collect(ch)
+	}
+}
@@ -0,0 +1,173 @@
+package gin_monitor
+
+import (
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// upperBounds returns the bucket upper bounds of the request_seconds series of the route
+func upperBounds(t *testing.T, family *dto.MetricFamily, route string) []float64 {
+	t.Helper()
+	for _, metric := range family.GetMetric() {
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == "addr" && pair.GetValue() == route {
+				var bounds []float64
+				for _, bucket := range metric.GetHistogram().GetBucket() {
+					bounds = append(bounds, bucket.GetUpperBound())
+				}
+				return bounds
+			}
+		}
+	}
+	t.Fatalf("expected a request_seconds series for %s", route)
+	return nil
+}
+
+func TestSetRouteBuckets(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+	exportBuckets := []float64{1, 5, 30, 60, 120}
+	if err := monitor.SetRouteBuckets("/export", exportBuckets); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	for _, route := range []string{"/export", "/ping", "/late"} {
+		r.GET(route, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+
+	serve(r, http.MethodGet, "/export")
+	serve(r, http.MethodGet, "/ping")
+	serve(r, http.MethodGet, "/late")
+
+	// setting buckets after the route was observed replaces its series
+	lateBuckets := []float64{0.5, 2}
+	if err := monitor.SetRouteBuckets("/late", lateBuckets); err != nil {
+		t.Fatal(err)
+	}
+	serve(r, http.MethodGet, "/late")
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := labelValues(family, "addr"); !reflect.DeepEqual(got, []string{"/export", "/late", "/ping"}) {
+		t.Fatalf("expected one series per route, got %v", got)
+	}
+
+	for route, want := range map[string][]float64{"/export": exportBuckets, "/ping": DefaultBuckets, "/late": lateBuckets} {
+		if got := upperBounds(t, family, route); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected buckets %v, got %v", route, want, got)
+		}
+	}
+
+	for _, metric := range family.GetMetric() {
+		if got := metric.GetHistogram().GetSampleCount(); got != 1 {
+			t.Errorf("expected one observation per series, got %d", got)
+		}
+	}
+}
+
+func TestSetRouteBucketsInvalid(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	for _, buckets := range [][]float64{{5, 1}, {1, 1}, {1, math.NaN()}} {
+		if err := monitor.SetRouteBuckets("/ok", buckets); err == nil {
+			t.Errorf("expected an error setting the buckets %v", buckets)
+		}
+	}
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	if w := serve(r, http.MethodGet, "/ok"); w.Code != http.StatusOK {
+		t.Errorf("expected the rejected buckets not to fail the requests, got status %d", w.Code)
+	}
+	if got := upperBounds(t, findFamily(t, registry, "request_seconds"), "/ok"); !reflect.DeepEqual(got, DefaultBuckets) {
+		t.Errorf("expected the route to keep the default buckets, got %v", got)
+	}
+}
+
+func TestSetRouteBucketsRewrittenAddr(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		route string
+		addr  string
+	}{
+		{name: "label func", opts: []Option{WithLabelFunc(func(c *gin.Context) string { return "/api" })}, route: "/export", addr: "/api"},
+		{name: "path normalization", opts: []Option{WithPathNormalization()}, route: "/Users/", addr: "/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, tt.opts...)
+			buckets := []float64{1, 5, 30}
+
+			r := gin.New()
+			r.RedirectTrailingSlash = false
+			r.Use(monitor.Prometheus())
+			for _, route := range []string{tt.route, "/users"} {
+				r.GET(route, func(c *gin.Context) { c.Status(http.StatusOK) })
+			}
+
+			// both routes are recorded with the same addr, before and after it is given buckets of its own
+			serve(r, http.MethodGet, tt.route)
+			if err := monitor.SetRouteBuckets(tt.addr, buckets); err != nil {
+				t.Fatal(err)
+			}
+			serve(r, http.MethodGet, tt.route)
+			serve(r, http.MethodGet, "/users")
+
+			if _, err := registry.Gather(); err != nil {
+				t.Fatalf("expected the metrics to be gathered, got %v", err)
+			}
+			family := findFamily(t, registry, "request_seconds")
+			if got := upperBounds(t, family, tt.addr); !reflect.DeepEqual(got, buckets) {
+				t.Errorf("expected buckets %v, got %v", buckets, got)
+			}
+		})
+	}
+}
+
+func TestWithNativeHistograms(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   []Option
+		native bool
+	}{
+		{name: "classic", native: false},
+		{name: "native", opts: []Option{WithNativeHistograms(1.1)}, native: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, tc.opts...)
+
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+			serve(r, http.MethodGet, "/ping")
+
+			family := findFamily(t, registry, "request_seconds")
+			if family == nil {
+				t.Fatal("expected request_seconds to have samples")
+			}
+			histogram := family.GetMetric()[0].GetHistogram()
+
+			if got := histogram.Schema != nil; got != tc.native {
+				t.Errorf("expected native histogram schema to be set: %v, got %v", tc.native, got)
+			}
+			if got := histogram.ZeroThreshold != nil; got != tc.native {
+				t.Errorf("expected native histogram zero threshold to be set: %v, got %v", tc.native, got)
+			}
+			// the classic buckets are kept either way
+			if got := upperBounds(t, family, "/ping"); !reflect.DeepEqual(got, DefaultBuckets) {
+				t.Errorf("expected buckets %v, got %v", DefaultBuckets, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package gin_monitor
+
+import (
+	"context"
+	"sync"
+)
+
+// CompositeDependencyChecker reports a cluster of dependencies under a single name,
+// which is UP if at least Quorum of its checkers are UP and DOWN otherwise.
+// A Quorum of zero or beyond the number of checkers requires every checker to be UP.
+// The checkers are checked concurrently within the deadline of the check, and the ones panicking or not returning
+// before it are counted as DOWN. The statuses of the last check are returned by ChildStatuses, they are not recorded as metrics.
+type CompositeDependencyChecker struct {
+	Name     string
+	Quorum   int
+	Checkers []DependencyChecker
+
+	mutex    sync.Mutex
+	children map[string]DependencyStatus
+}
+
+// NewCompositeDependencyChecker creates a checker reporting UP if at least quorum of the checkers are UP.
+func NewCompositeDependencyChecker(name string, quorum int, checkers ...DependencyChecker) *CompositeDependencyChecker {
+	return &CompositeDependencyChecker{Name: name, Quorum: quorum, Checkers: checkers}
+}
+
+func (c *CompositeDependencyChecker) GetDependencyName() string {
+	return c.Name
+}
+
+// Check checks the checkers without a deadline, as CheckContext with a background context.
+func (c *CompositeDependencyChecker) Check() DependencyStatus {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext checks the checkers until the context is done, those implementing CheckContext receiving the context.
+// It is called by the monitor with the deadline of the check, even when added by AddDependencyChecker.
+func (c *CompositeDependencyChecker) CheckContext(ctx context.Context) DependencyStatus {
+	statuses := make([]DependencyStatus, len(c.Checkers))
+	var wg sync.WaitGroup
+	for i, checker := range c.Checkers {
+		wg.Add(1)
+		go func(i int, checker DependencyChecker) {
+			defer wg.Done()
+			statuses[i] = checkChild(ctx, checker)
+		}(i, checker)
+	}
+	wg.Wait()
+
+	up := 0
+	children := make(map[string]DependencyStatus, len(c.Checkers))
+	for i, checker := range c.Checkers {
+		if statuses[i] == UP {
+			up++
+		}
+		children[checker.GetDependencyName()] = statuses[i]
+	}
+
+	c.mutex.Lock()
+	c.children = children
+	c.mutex.Unlock()
+
+	quorum := c.Quorum
+	if quorum <= 0 || quorum > len(c.Checkers) {
+		quorum = len(c.Checkers)
+	}
+	if up >= quorum {
+		return UP
+	}
+	return DOWN
+}
+
+// ChildStatuses returns the status every checker reported in the last check, by dependency name.
+func (c *CompositeDependencyChecker) ChildStatuses() map[string]DependencyStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	statuses := make(map[string]DependencyStatus, len(c.children))
+	for name, status := range c.children {
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// checkChild checks the child checker, reporting DOWN if it panics or does not return before the context is done.
+// Checkers that ignore the context keep running in background until they return.
+func checkChild(ctx context.Context, checker DependencyChecker) DependencyStatus {
+	result := make(chan DependencyStatus, 1)
+	go func() {
+		defer func() {
+			if recover() != nil {
+				result <- DOWN
+			}
+		}()
+		result <- contextCheckerAdapter{checker}.Check(ctx)
+	}()
+
+	select {
+	case status := <-result:
+		if ctx.Err() != nil {
+			return DOWN
+		}
+		return status
+	case <-ctx.Done():
+		return DOWN
+	}
+}
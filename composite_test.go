@@ -0,0 +1,112 @@
+package gin_monitor
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// nodes returns static checkers reporting the given statuses, named after their index
+func nodes(statuses ...DependencyStatus) []DependencyChecker {
+	checkers := make([]DependencyChecker, len(statuses))
+	for i, status := range statuses {
+		checkers[i] = &staticChecker{name: fmt.Sprintf("node-%d", i), status: status}
+	}
+	return checkers
+}
+
+func TestCompositeDependencyChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		quorum   int
+		statuses []DependencyStatus
+		want     DependencyStatus
+	}{
+		{name: "all up", quorum: 2, statuses: []DependencyStatus{UP, UP, UP}, want: UP},
+		{name: "quorum reached", quorum: 2, statuses: []DependencyStatus{UP, DOWN, UP}, want: UP},
+		{name: "one short of quorum", quorum: 2, statuses: []DependencyStatus{UP, DOWN, DOWN}, want: DOWN},
+		{name: "degraded is not up", quorum: 2, statuses: []DependencyStatus{UP, DEGRADED, DOWN}, want: DOWN},
+		{name: "all down", quorum: 1, statuses: []DependencyStatus{DOWN, DOWN, DOWN}, want: DOWN},
+		{name: "zero quorum requires all", quorum: 0, statuses: []DependencyStatus{UP, UP, DOWN}, want: DOWN},
+		{name: "quorum beyond the checkers requires all", quorum: 5, statuses: []DependencyStatus{UP, UP, UP}, want: UP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewCompositeDependencyChecker("cluster", tt.quorum, nodes(tt.statuses...)...)
+			if got := checker.Check(); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+
+			want := map[string]DependencyStatus{}
+			for i, status := range tt.statuses {
+				want[fmt.Sprintf("node-%d", i)] = status
+			}
+			if got := checker.ChildStatuses(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected child statuses %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestAddCompositeDependencyChecker(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	if err := monitor.AddDependencyChecker(NewCompositeDependencyChecker("cluster", 2, nodes(UP, DOWN, UP)...), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the composite checker to run", func() bool { return dependencyStatus(monitor, "cluster") == UP })
+
+	if got := monitor.DependencyStatuses(); !reflect.DeepEqual(got, map[string]DependencyStatus{"cluster": UP}) {
+		t.Errorf("expected a single aggregate dependency, got %v", got)
+	}
+}
+
+// blockingChecker blocks until released
+type blockingChecker struct {
+	release chan struct{}
+}
+
+func (c *blockingChecker) GetDependencyName() string { return "blocking" }
+
+func (c *blockingChecker) Check() DependencyStatus {
+	<-c.release
+	return UP
+}
+
+func TestCompositeDependencyCheckerPanickingChild(t *testing.T) {
+	checker := NewCompositeDependencyChecker("cluster", 2, append(nodes(UP, UP), &panickingChecker{})...)
+
+	if got := checker.Check(); got != UP {
+		t.Errorf("expected the quorum to be reached despite the panicking child, got %v", got)
+	}
+	if got := checker.ChildStatuses()["panicking"]; got != DOWN {
+		t.Errorf("expected the panicking child to be DOWN, got %v", got)
+	}
+}
+
+func TestAddCompositeDependencyCheckerPanickingChild(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	if err := monitor.AddDependencyChecker(NewCompositeDependencyChecker("cluster", 1, &panickingChecker{}), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the composite checker to report DOWN", func() bool { return dependencyStatus(monitor, "cluster") == DOWN })
+}
+
+func TestCompositeDependencyCheckerTimeout(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	blocking := &blockingChecker{release: make(chan struct{})}
+	defer close(blocking.release)
+	composite := NewCompositeDependencyChecker("cluster", 2, append(nodes(UP), blocking)...)
+	if err := monitor.AddDependencyChecker(composite, time.Hour, WithCheckTimeout(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the composite checker to report DOWN", func() bool { return dependencyStatus(monitor, "cluster") == DOWN })
+	// the composite returns once the deadline is exceeded, racing with the monitor recording the timeout
+	want := map[string]DependencyStatus{"node-0": UP, "blocking": DOWN}
+	waitFor(t, "the hung child to be DOWN", func() bool { return reflect.DeepEqual(composite.ChildStatuses(), want) })
+}
@@ -0,0 +1,364 @@
+package gin_monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DependencyStatus is the type to represent UP, DOWN, DEGRADED or UNKNOWN states
+type DependencyStatus int
+
+// DependencyChecker specifies the methods a checker must implement.
+type DependencyChecker interface {
+	GetDependencyName() string
+	Check() DependencyStatus
+}
+
+// ContextDependencyChecker specifies the methods a context-aware checker must implement.
+// The context is done when the check deadline is exceeded.
+type ContextDependencyChecker interface {
+	GetDependencyName() string
+	Check(ctx context.Context) DependencyStatus
+}
+
+const (
+	DOWN DependencyStatus = iota
+	UP
+	// DEGRADED reports a dependency that is partially working
+	DEGRADED
+	// UNKNOWN reports a dependency that was not checked yet
+	UNKNOWN
+)
+
+// String returns the name of the status
+func (s DependencyStatus) String() string {
+	switch s {
+	case UP:
+		return "UP"
+	case DEGRADED:
+		return "DEGRADED"
+	case UNKNOWN:
+		return "UNKNOWN"
+	default:
+		return "DOWN"
+	}
+}
+
+// isUp returns the gin_dependency_up value of the status, 1 for UP and 0 otherwise
+func isUp(status DependencyStatus) float64 {
+	if status == UP {
+		return 1
+	}
+	return 0
+}
+
+// CheckerOption configures a dependency checker added to the Monitor.
+type CheckerOption func(*checkerConfig)
+
+type checkerConfig struct {
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	probes  probe
+}
+
+func newCheckerConfig(checkingPeriod time.Duration, opts ...CheckerOption) checkerConfig {
+	cfg := checkerConfig{timeout: checkingPeriod}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.probes == 0 {
+		cfg.probes = readinessProbe
+	}
+	return cfg
+}
+
+// probe is the set of health probes a dependency affects
+type probe uint8
+
+const (
+	readinessProbe probe = 1 << iota
+	livenessProbe
+
+	anyProbe = readinessProbe | livenessProbe
+)
+
+var (
+	// Readiness makes the dependency affect the status reported by ReadinessHandler,
+	// which is the default of checkers added without Readiness nor Liveness.
+	Readiness CheckerOption = func(cfg *checkerConfig) { cfg.probes |= readinessProbe }
+
+	// Liveness makes the dependency affect the status reported by LivenessHandler.
+	// Checkers added with both Liveness and Readiness affect both probes.
+	Liveness CheckerOption = func(cfg *checkerConfig) { cfg.probes |= livenessProbe }
+)
+
+// WithCheckTimeout sets the deadline of each check, defaults to the checking period.
+// A check exceeding the deadline records the dependency as DOWN.
+func WithCheckTimeout(timeout time.Duration) CheckerOption {
+	return func(cfg *checkerConfig) {
+		if timeout > 0 {
+			cfg.timeout = timeout
+		}
+	}
+}
+
+// WithCheckRetries retries a check reporting DOWN up to the given number of times before recording it,
+// waiting for the backoff before the first retry and doubling it before each following one.
+// Each attempt has its own deadline, and the first one not reporting DOWN is recorded. Defaults to no retries.
+func WithCheckRetries(retries int, backoff time.Duration) CheckerOption {
+	return func(cfg *checkerConfig) {
+		if retries > 0 {
+			cfg.retries = retries
+		}
+		if backoff > 0 {
+			cfg.backoff = backoff
+		}
+	}
+}
+
+// contextAwareChecker is implemented by the checkers that also have a context-aware check, such as CompositeDependencyChecker
+type contextAwareChecker interface {
+	CheckContext(ctx context.Context) DependencyStatus
+}
+
+// contextCheckerAdapter adapts a DependencyChecker to the ContextDependencyChecker interface,
+// passing the context to its CheckContext method when it has one
+type contextCheckerAdapter struct {
+	DependencyChecker
+}
+
+func (a contextCheckerAdapter) Check(ctx context.Context) DependencyStatus {
+	if checker, ok := a.DependencyChecker.(contextAwareChecker); ok {
+		return checker.CheckContext(ctx)
+	}
+	return a.DependencyChecker.Check()
+}
+
+// recoveringChecker reports DOWN when the checker it wraps panics, counting the panic
+type recoveringChecker struct {
+	ContextDependencyChecker
+	panics prometheus.Counter
+}
+
+func (c recoveringChecker) Check(ctx context.Context) (status DependencyStatus) {
+	defer func() {
+		if recover() != nil {
+			c.panics.Inc()
+			status = DOWN
+		}
+	}()
+	return c.ContextDependencyChecker.Check(ctx)
+}
+
+// AddDependencyChecker periodically executes the checker and collects the dependency state metrics
+// It returns an error if a checker with the same name was already added or the checking period is not positive.
+func (m *Monitor) AddDependencyChecker(checker DependencyChecker, checkingPeriod time.Duration, opts ...CheckerOption) error {
+	return m.AddContextDependencyChecker(contextCheckerAdapter{checker}, checkingPeriod, opts...)
+}
+
+// AddContextDependencyChecker periodically executes the context-aware checker and collects the dependency state metrics
+// It returns an error if a checker with the same name was already added or the checking period is not positive.
+func (m *Monitor) AddContextDependencyChecker(checker ContextDependencyChecker, checkingPeriod time.Duration, opts ...CheckerOption) error {
+	_, err := m.addDependency(checker, checkingPeriod, newCheckerConfig(checkingPeriod, opts...))
+	return err
+}
+
+// RemoveDependencyChecker stops the checker of the named dependency and deletes its metrics.
+// It returns false if no checker with that name was added.
+func (m *Monitor) RemoveDependencyChecker(name string) bool {
+	m.dependenciesMutex.Lock()
+	defer m.dependenciesMutex.Unlock()
+
+	d, ok := m.dependencies[name]
+	if !ok {
+		return false
+	}
+
+	delete(m.dependencies, name)
+	d.cancel()
+	d.scheduler.wakeUp()
+
+	m.dependencyUP.DeleteLabelValues(name)
+	m.dependencyIsUp.DeleteLabelValues(name)
+	m.dependencyCheckTime.DeleteLabelValues(name)
+	m.dependencyLastCheck.DeleteLabelValues(name)
+	m.dependencyCheckPanics.DeleteLabelValues(name)
+	m.dependencyInterval.DeleteLabelValues(name)
+	return true
+}
+
+// DependencyStatuses returns the last known status of every registered dependency,
+// reporting UNKNOWN for the ones not checked yet.
+func (m *Monitor) DependencyStatuses() map[string]DependencyStatus {
+	return m.dependencyStatuses(anyProbe)
+}
+
+// dependencyStatuses returns the last known status of the registered dependencies affecting any of the probes
+func (m *Monitor) dependencyStatuses(probes probe) map[string]DependencyStatus {
+	m.dependenciesMutex.RLock()
+	defer m.dependenciesMutex.RUnlock()
+
+	statuses := make(map[string]DependencyStatus, len(m.dependencies))
+	for name, d := range m.dependencies {
+		if d.probes&probes != 0 {
+			statuses[name] = d.status
+		}
+	}
+	return statuses
+}
+
+// Shutdown stops every dependency checker and waits for them to exit or the context to be done.
+// It is safe to call Shutdown more than once.
+func (m *Monitor) Shutdown(ctx context.Context) error {
+	m.dependenciesMutex.Lock()
+	m.cancel()
+	m.dependenciesMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.checkers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runCheck executes the checker, reporting DOWN if it does not return before the timeout.
+// Checkers that ignore the context keep running in background until they return.
+func runCheck(parent context.Context, checker ContextDependencyChecker, timeout time.Duration) DependencyStatus {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	result := make(chan DependencyStatus, 1)
+	go func() {
+		result <- checker.Check(ctx)
+	}()
+
+	select {
+	case status := <-result:
+		if ctx.Err() != nil {
+			return DOWN
+		}
+		return status
+	case <-ctx.Done():
+		return DOWN
+	}
+}
+
+// runCheckWithRetries executes the checker, retrying with exponential backoff while it reports DOWN,
+// until the retries are exhausted or the context is done
+func runCheckWithRetries(ctx context.Context, checker ContextDependencyChecker, cfg checkerConfig) DependencyStatus {
+	status := runCheck(ctx, checker, cfg.timeout)
+	backoff := cfg.backoff
+	for retry := 0; retry < cfg.retries && status == DOWN; retry++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return DOWN
+		}
+		status = runCheck(ctx, checker, cfg.timeout)
+		backoff *= 2
+	}
+	return status
+}
+
+// dependency holds the state of a dependency checker added to the Monitor
+type dependency struct {
+	name      string
+	status    DependencyStatus
+	checked   bool
+	probes    probe
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	scheduler *checkScheduler
+}
+
+// addDependency registers the dependency of the checker and schedules its checks,
+// failing if the checking period is not positive, the name is taken or the monitor was shut down
+func (m *Monitor) addDependency(checker ContextDependencyChecker, checkingPeriod time.Duration, cfg checkerConfig) (*dependency, error) {
+	m.dependenciesMutex.Lock()
+	defer m.dependenciesMutex.Unlock()
+
+	name := checker.GetDependencyName()
+	if checkingPeriod <= 0 {
+		return nil, fmt.Errorf("dependency %q has a non-positive checking period %v", name, checkingPeriod)
+	}
+	if _, ok := m.dependencies[name]; ok {
+		return nil, fmt.Errorf("dependency %q already has a checker", name)
+	}
+	if m.ctx.Err() != nil {
+		return nil, errors.New("monitor was shut down")
+	}
+
+	d := &dependency{name: name, status: UNKNOWN, probes: cfg.probes, done: make(chan struct{})}
+	d.ctx, d.cancel = context.WithCancel(m.ctx)
+	m.dependencies[name] = d
+	m.dependencyUP.WithLabelValues(name).Set(float64(d.status))
+	m.dependencyIsUp.WithLabelValues(name).Set(isUp(d.status))
+	m.dependencyInterval.WithLabelValues(name).Set(checkingPeriod.Seconds())
+
+	checker = recoveringChecker{checker, m.dependencyCheckPanics.WithLabelValues(name)}
+	m.scheduleChecks(d, checker, checkingPeriod, cfg)
+	return d, nil
+}
+
+// recordCheck caches the status of the dependency and collects its check metrics,
+// unless the dependency was removed while it was being checked
+func (m *Monitor) recordCheck(d *dependency, status DependencyStatus, duration time.Duration) {
+	m.dependenciesMutex.Lock()
+	defer m.dependenciesMutex.Unlock()
+
+	if m.dependencies[d.name] != d {
+		return
+	}
+
+	if m.statusChanges != nil && d.checked && status != d.status {
+		// drop the transition rather than delaying the checks when the hook falls behind
+		select {
+		case m.statusChanges <- statusChange{name: d.name, from: d.status, to: status}:
+		default:
+		}
+	}
+	d.status = status
+	d.checked = true
+	m.dependencyUP.WithLabelValues(d.name).Set(float64(status))
+	m.dependencyIsUp.WithLabelValues(d.name).Set(isUp(status))
+	m.dependencyCheckTime.WithLabelValues(d.name).Observe(duration.Seconds())
+	m.dependencyLastCheck.WithLabelValues(d.name).Set(float64(time.Now().Unix()))
+}
+
+// statusChangeQueueSize is how many status transitions wait for the status change hook before new ones are dropped
+const statusChangeQueueSize = 64
+
+// statusChange is a status transition recorded by a dependency check
+type statusChange struct {
+	name     string
+	from, to DependencyStatus
+}
+
+// runStatusChangeHook calls the status change hook with the queued transitions, one at a time and in order,
+// until the monitor is shut down
+func (m *Monitor) runStatusChangeHook() {
+	defer m.checkers.Done()
+	for {
+		select {
+		case change := <-m.statusChanges:
+			m.statusChangeHook(change.name, change.from, change.to)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,643 @@
+package gin_monitor
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// staticChecker always reports the same status
+type staticChecker struct {
+	name   string
+	status DependencyStatus
+}
+
+func (c *staticChecker) GetDependencyName() string { return c.name }
+
+func (c *staticChecker) Check() DependencyStatus { return c.status }
+
+// hangingChecker reports UP on its first check and then blocks until released
+type hangingChecker struct {
+	calls   int32
+	release chan struct{}
+}
+
+func (c *hangingChecker) GetDependencyName() string { return "hanging" }
+
+func (c *hangingChecker) Check() DependencyStatus {
+	if atomic.AddInt32(&c.calls, 1) > 1 {
+		<-c.release
+	}
+	return UP
+}
+
+// contextChecker blocks until its context is done
+type contextChecker struct{}
+
+func (c *contextChecker) GetDependencyName() string { return "context" }
+
+func (c *contextChecker) Check(ctx context.Context) DependencyStatus {
+	<-ctx.Done()
+	return UP
+}
+
+// waitFor polls the condition until it holds or two seconds have passed.
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// dependencyStatus returns the cached status of the dependency, or DOWN if it is not registered.
+func dependencyStatus(m *Monitor, name string) DependencyStatus {
+	m.dependenciesMutex.RLock()
+	defer m.dependenciesMutex.RUnlock()
+	if d, ok := m.dependencies[name]; ok {
+		return d.status
+	}
+	return DOWN
+}
+
+// setDependencyStatus registers the dependency, without a checker, and records its status.
+func setDependencyStatus(t *testing.T, m *Monitor, name string, status DependencyStatus) {
+	t.Helper()
+	d := &dependency{name: name, probes: readinessProbe, done: make(chan struct{})}
+	d.ctx, d.cancel = context.WithCancel(m.ctx)
+	m.dependenciesMutex.Lock()
+	m.dependencies[name] = d
+	m.dependenciesMutex.Unlock()
+	m.recordCheck(d, status, 0)
+}
+
+func TestAddDependencyCheckerTimeout(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	checker := &hangingChecker{release: make(chan struct{})}
+	defer close(checker.release)
+	monitor.AddDependencyChecker(checker, 10*time.Millisecond, WithCheckTimeout(20*time.Millisecond))
+
+	waitFor(t, "the first check to report UP", func() bool { return dependencyStatus(monitor, "hanging") == UP })
+	waitFor(t, "the hanging check to report DOWN", func() bool { return dependencyStatus(monitor, "hanging") == DOWN })
+}
+
+func TestRunCheckTimeout(t *testing.T) {
+	started := time.Now()
+	if status := runCheck(context.Background(), &contextChecker{}, 20*time.Millisecond); status != DOWN {
+		t.Errorf("expected a check exceeding its deadline to report DOWN, got %v", status)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the check to be abandoned at its deadline, took %v", elapsed)
+	}
+
+	if status := runCheck(context.Background(), contextCheckerAdapter{&staticChecker{name: "static", status: UP}}, time.Second); status != UP {
+		t.Errorf("expected the adapted checker to report UP, got %v", status)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	monitor, _ := newTestMonitor(t)
+	for _, name := range []string{"first", "second", "third"} {
+		monitor.AddDependencyChecker(&staticChecker{name: name, status: UP}, 5*time.Millisecond)
+	}
+	waitFor(t, "the checkers to run", func() bool { return dependencyStatus(monitor, "third") == UP })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := monitor.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := monitor.Shutdown(ctx); err != nil {
+		t.Fatalf("expected a second shutdown to be safe, got %v", err)
+	}
+
+	waitFor(t, "the checker goroutines to exit", func() bool { return runtime.NumGoroutine() <= before })
+}
+
+// slowChecker sleeps before reporting UP
+type slowChecker struct {
+	delay time.Duration
+}
+
+func (c *slowChecker) GetDependencyName() string { return "slow" }
+
+func (c *slowChecker) Check() DependencyStatus {
+	time.Sleep(c.delay)
+	return UP
+}
+
+func TestDependencyCheckDuration(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	const delay = 30 * time.Millisecond
+	monitor.AddDependencyChecker(&slowChecker{delay: delay}, 10*time.Millisecond, WithCheckTimeout(time.Second))
+
+	waitFor(t, "a check to be observed", func() bool {
+		return findFamily(t, registry, "gin_dependency_check_duration_seconds") != nil
+	})
+
+	histogram := findFamily(t, registry, "gin_dependency_check_duration_seconds").GetMetric()[0].GetHistogram()
+	if histogram.GetSampleCount() == 0 || histogram.GetSampleSum() < delay.Seconds()*float64(histogram.GetSampleCount()) {
+		t.Errorf("expected each check to last at least %v, got %d checks summing %vs", delay, histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+}
+
+func TestDependencyLastCheckTimestamp(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	monitor.AddDependencyChecker(&staticChecker{name: "static", status: UP}, 10*time.Millisecond)
+
+	waitFor(t, "a check to complete", func() bool {
+		return findFamily(t, registry, "gin_dependency_last_check_timestamp_seconds") != nil
+	})
+
+	timestamp := findFamily(t, registry, "gin_dependency_last_check_timestamp_seconds").GetMetric()[0].GetGauge().GetValue()
+	if delta := float64(time.Now().Unix()) - timestamp; delta < 0 || delta > 2 {
+		t.Errorf("expected the last check timestamp to be close to now, got %v seconds ago", delta)
+	}
+}
+
+func TestRemoveDependencyChecker(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	monitor.AddDependencyChecker(&staticChecker{name: "optional", status: UP}, 5*time.Millisecond)
+	monitor.AddDependencyChecker(&staticChecker{name: "required", status: UP}, 5*time.Millisecond)
+	waitFor(t, "the checkers to run", func() bool {
+		return dependencyStatus(monitor, "optional") == UP && dependencyStatus(monitor, "required") == UP
+	})
+
+	monitor.dependenciesMutex.RLock()
+	removed := monitor.dependencies["optional"]
+	monitor.dependenciesMutex.RUnlock()
+
+	if !monitor.RemoveDependencyChecker("optional") {
+		t.Fatal("expected the optional checker to be removed")
+	}
+	if monitor.RemoveDependencyChecker("optional") {
+		t.Error("expected removing the optional checker twice to report false")
+	}
+
+	select {
+	case <-removed.done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the removed checker goroutine to stop")
+	}
+
+	for _, name := range []string{"dependency_up", "gin_dependency_up", "gin_dependency_check_duration_seconds", "gin_dependency_last_check_timestamp_seconds"} {
+		if got := labelValues(findFamily(t, registry, name), "name"); !reflect.DeepEqual(got, []string{"required"}) {
+			t.Errorf("%s: expected only the required dependency to be reported, got %v", name, got)
+		}
+	}
+}
+
+func TestAddDependencyCheckerConcurrently(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	const checkers = 50
+	var wg sync.WaitGroup
+	var failures int32
+	for i := 0; i < checkers; i++ {
+		wg.Add(2)
+		name := fmt.Sprintf("dependency-%d", i)
+		for j := 0; j < 2; j++ {
+			go func() {
+				defer wg.Done()
+				if err := monitor.AddDependencyChecker(&staticChecker{name: name, status: UP}, 5*time.Millisecond); err != nil {
+					atomic.AddInt32(&failures, 1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if failures != checkers {
+		t.Errorf("expected each duplicated name to be rejected once, got %d rejections", failures)
+	}
+
+	monitor.dependenciesMutex.RLock()
+	registered := len(monitor.dependencies)
+	monitor.dependenciesMutex.RUnlock()
+	if registered != checkers {
+		t.Errorf("expected %d dependencies, got %d", checkers, registered)
+	}
+}
+
+func TestAddDependencyCheckerAfterShutdown(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+	if err := monitor.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := monitor.AddDependencyChecker(&staticChecker{name: "late", status: UP}, time.Second); err == nil {
+		t.Error("expected adding a checker after shutdown to fail")
+	}
+}
+
+func TestJitterInterval(t *testing.T) {
+	const interval = time.Second
+	if got := jitterInterval(interval, 0); got != interval {
+		t.Errorf("expected no jitter by default, got %v", got)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if got := jitterInterval(interval, 0.2); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("expected the interval to stay within ±20%%, got %v", got)
+		}
+	}
+}
+
+// timestampChecker records when it is checked
+type timestampChecker struct {
+	mutex  sync.Mutex
+	checks []time.Time
+}
+
+func (c *timestampChecker) GetDependencyName() string { return "timestamp" }
+
+func (c *timestampChecker) Check() DependencyStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checks = append(c.checks, time.Now())
+	return UP
+}
+
+func (c *timestampChecker) times() []time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]time.Time(nil), c.checks...)
+}
+
+func TestAddDependencyCheckerNonPositivePeriod(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	for _, period := range []time.Duration{0, -time.Second} {
+		if err := monitor.AddDependencyChecker(&staticChecker{name: "db", status: UP}, period); err == nil {
+			t.Errorf("expected an error adding a checker with a checking period of %v", period)
+		}
+	}
+	if got := monitor.DependencyStatuses(); len(got) != 0 {
+		t.Errorf("expected the rejected checker not to be registered, got %v", got)
+	}
+}
+
+func TestAddDependencyCheckerJitter(t *testing.T) {
+	monitor, _ := newTestMonitor(t, WithCheckJitter(0.2))
+
+	const period, slack = 100 * time.Millisecond, 15 * time.Millisecond
+	checker := &timestampChecker{}
+	if err := monitor.AddDependencyChecker(checker, period); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "several check cycles", func() bool { return len(checker.times()) >= 6 })
+
+	checks := checker.times()
+	for i := 1; i < len(checks); i++ {
+		if interval := checks[i].Sub(checks[i-1]); interval < 80*time.Millisecond-slack || interval > 120*time.Millisecond+slack {
+			t.Errorf("interval %d lasted %v, out of the jittered bounds", i, interval)
+		}
+	}
+}
+
+func TestAddDependencyCheckerUnknownBeforeFirstCheck(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	// the first check blocks until the monitor is shut down
+	if err := monitor.AddContextDependencyChecker(&contextChecker{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := dependencyStatus(monitor, "context"); status != UNKNOWN {
+		t.Errorf("expected a fresh checker to be UNKNOWN, got %v", status)
+	}
+	if got := findFamily(t, registry, "dependency_up").GetMetric()[0].GetGauge().GetValue(); got != float64(UNKNOWN) {
+		t.Errorf("expected the dependency_up gauge to be %v, got %v", float64(UNKNOWN), got)
+	}
+}
+
+func TestDependencyUpGauge(t *testing.T) {
+	want := map[DependencyStatus]float64{UP: 1, DOWN: 0, DEGRADED: 0, UNKNOWN: 0}
+	for status, up := range want {
+		t.Run(status.String(), func(t *testing.T) {
+			monitor, registry := newTestMonitor(t)
+			setDependencyStatus(t, monitor, "db", status)
+
+			if got, err := GatherValue(registry, "gin_dependency_up", prometheus.Labels{"name": "db"}); err != nil || got != up {
+				t.Errorf("expected gin_dependency_up to be %v, got %v (%v)", up, got, err)
+			}
+			if got, err := GatherValue(registry, "dependency_up", prometheus.Labels{"name": "db"}); err != nil || got != float64(status) {
+				t.Errorf("expected dependency_up to keep the status %v, got %v (%v)", float64(status), got, err)
+			}
+		})
+	}
+}
+
+func TestAddDependencyCheckerFirstCheck(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	if err := monitor.AddDependencyChecker(&staticChecker{name: "prompt", status: UP}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for dependencyStatus(monitor, "prompt") != UP {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the first check to run right after the checker was added")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDependencyStatuses(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	for _, checker := range []*staticChecker{{name: "up", status: UP}, {name: "down", status: DOWN}, {name: "degraded", status: DEGRADED}} {
+		if err := monitor.AddDependencyChecker(checker, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := monitor.AddContextDependencyChecker(&contextChecker{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the checkers to run", func() bool {
+		return len(findFamily(t, registry, "gin_dependency_last_check_timestamp_seconds").GetMetric()) == 3
+	})
+
+	want := map[string]DependencyStatus{"up": UP, "down": DOWN, "degraded": DEGRADED, "context": UNKNOWN}
+	statuses := monitor.DependencyStatuses()
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("expected statuses %v, got %v", want, statuses)
+	}
+
+	for _, metric := range findFamily(t, registry, "dependency_up").GetMetric() {
+		name := metric.GetLabel()[0].GetValue()
+		if got := DependencyStatus(metric.GetGauge().GetValue()); got != statuses[name] {
+			t.Errorf("%s: expected the gauge to report %v, got %v", name, statuses[name], got)
+		}
+	}
+}
+
+// flakyChecker reports DOWN for its first failures checks and UP afterwards
+type flakyChecker struct {
+	failures int32
+	calls    int32
+}
+
+func (c *flakyChecker) GetDependencyName() string { return "flaky" }
+
+func (c *flakyChecker) Check() DependencyStatus {
+	if atomic.AddInt32(&c.calls, 1) <= c.failures {
+		return DOWN
+	}
+	return UP
+}
+
+func TestAddDependencyCheckerRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures int32
+		opts     []CheckerOption
+		status   DependencyStatus
+		calls    int32
+	}{
+		{name: "no retries", failures: 1, status: DOWN, calls: 1},
+		{name: "recovers on retry", failures: 1, opts: []CheckerOption{WithCheckRetries(2, time.Millisecond)}, status: UP, calls: 2},
+		{name: "retries exhausted", failures: 3, opts: []CheckerOption{WithCheckRetries(2, time.Millisecond)}, status: DOWN, calls: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			monitor, _ := newTestMonitor(t)
+			checker := &flakyChecker{failures: tc.failures}
+			monitor.AddDependencyChecker(checker, time.Hour, tc.opts...)
+
+			waitFor(t, "the first check to be recorded", func() bool {
+				return dependencyStatus(monitor, "flaky") != UNKNOWN
+			})
+			if got := dependencyStatus(monitor, "flaky"); got != tc.status {
+				t.Errorf("expected status %v, got %v", tc.status, got)
+			}
+			if got := atomic.LoadInt32(&checker.calls); got != tc.calls {
+				t.Errorf("expected %d calls, got %d", tc.calls, got)
+			}
+		})
+	}
+}
+
+// panickingChecker panics on every check
+type panickingChecker struct {
+	calls int32
+}
+
+func (c *panickingChecker) GetDependencyName() string { return "panicking" }
+
+func (c *panickingChecker) Check() DependencyStatus {
+	atomic.AddInt32(&c.calls, 1)
+	panic("misconfigured client")
+}
+
+func TestAddDependencyCheckerPanics(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+	checker := &panickingChecker{}
+	monitor.AddDependencyChecker(checker, 10*time.Millisecond)
+
+	// the checker keeps being scheduled after panicking
+	waitFor(t, "the checker to be called again after panicking", func() bool {
+		return atomic.LoadInt32(&checker.calls) >= 3
+	})
+	waitFor(t, "the panics to be counted", func() bool {
+		family := findFamily(t, registry, "gin_dependency_check_panics_total")
+		return family != nil && family.GetMetric()[0].GetCounter().GetValue() >= 2
+	})
+	if got := dependencyStatus(monitor, "panicking"); got != DOWN {
+		t.Errorf("expected a panicking checker to be recorded as DOWN, got %v", got)
+	}
+
+	monitor.RemoveDependencyChecker("panicking")
+	if family := findFamily(t, registry, "gin_dependency_check_panics_total"); family != nil {
+		t.Errorf("expected the panics of a removed checker to be deleted, got %v", family)
+	}
+}
+
+func TestDependencyCheckersActive(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	active := func() float64 {
+		return findFamily(t, registry, "gin_dependency_checkers_active").GetMetric()[0].GetGauge().GetValue()
+	}
+	if got := active(); got != 0 {
+		t.Fatalf("expected no active checkers, got %v", got)
+	}
+
+	for _, name := range []string{"db", "cache", "queue"} {
+		monitor.AddDependencyChecker(&staticChecker{name: name, status: UP}, time.Hour)
+	}
+	waitFor(t, "three active checkers", func() bool { return active() == 3 })
+
+	monitor.RemoveDependencyChecker("cache")
+	waitFor(t, "two active checkers", func() bool { return active() == 2 })
+
+	if err := monitor.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := active(); got != 0 {
+		t.Errorf("expected no active checkers after shutdown, got %v", got)
+	}
+}
+
+func TestDependencyCheckInterval(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	monitor.AddDependencyChecker(&staticChecker{name: "db", status: UP}, 30*time.Second)
+	monitor.AddDependencyChecker(&staticChecker{name: "cache", status: UP}, 1500*time.Millisecond)
+
+	for name, want := range map[string]float64{"db": 30, "cache": 1.5} {
+		if got, err := GatherValue(registry, "gin_dependency_check_interval_seconds", prometheus.Labels{"name": name}); err != nil || got != want {
+			t.Errorf("%s: expected an interval of %vs, got %v (%v)", name, want, got, err)
+		}
+	}
+
+	// re-registering the checker updates its interval
+	monitor.RemoveDependencyChecker("db")
+	if _, err := GatherValue(registry, "gin_dependency_check_interval_seconds", prometheus.Labels{"name": "db"}); err == nil {
+		t.Error("expected the interval of a removed checker to be deleted")
+	}
+	monitor.AddDependencyChecker(&staticChecker{name: "db", status: UP}, time.Minute)
+	if got, err := GatherValue(registry, "gin_dependency_check_interval_seconds", prometheus.Labels{"name": "db"}); err != nil || got != 60 {
+		t.Errorf("expected the updated interval of 60s, got %v (%v)", got, err)
+	}
+}
+
+// sequenceChecker reports the statuses in order, repeating the last one once they are exhausted
+type sequenceChecker struct {
+	mutex    sync.Mutex
+	statuses []DependencyStatus
+	calls    int
+}
+
+func (c *sequenceChecker) GetDependencyName() string { return "sequence" }
+
+func (c *sequenceChecker) Check() DependencyStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status := c.statuses[len(c.statuses)-1]
+	if c.calls < len(c.statuses) {
+		status = c.statuses[c.calls]
+	}
+	c.calls++
+	return status
+}
+
+func (c *sequenceChecker) checked() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.calls
+}
+
+func TestWithDependencyStatusChangeHook(t *testing.T) {
+	var mutex sync.Mutex
+	var transitions []string
+	monitor, _ := newTestMonitor(t, WithDependencyStatusChangeHook(func(name string, from, to DependencyStatus) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		transitions = append(transitions, fmt.Sprintf("%s: %v -> %v", name, from, to))
+	}))
+
+	checker := &sequenceChecker{statuses: []DependencyStatus{UP, UP, DOWN, DOWN, DEGRADED, UP}}
+	monitor.AddDependencyChecker(checker, 10*time.Millisecond)
+	waitFor(t, "the sequence to be checked", func() bool { return checker.checked() > len(checker.statuses)+2 })
+
+	want := []string{"sequence: UP -> DOWN", "sequence: DOWN -> DEGRADED", "sequence: DEGRADED -> UP"}
+	waitFor(t, "the hooks to be called", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(transitions) >= len(want)
+	})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("expected transitions %v, got %v", want, transitions)
+	}
+}
+
+func TestWithDependencyStatusChangeHookOrder(t *testing.T) {
+	var mutex sync.Mutex
+	var transitions []string
+	monitor, _ := newTestMonitor(t, WithDependencyStatusChangeHook(func(name string, from, to DependencyStatus) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		transitions = append(transitions, fmt.Sprintf("%v -> %v", from, to))
+	}))
+
+	// flap without pausing between the checks, which must still reach the hook in order
+	setDependencyStatus(t, monitor, "flapping", UP)
+	monitor.dependenciesMutex.RLock()
+	d := monitor.dependencies["flapping"]
+	monitor.dependenciesMutex.RUnlock()
+	const flaps = 20
+	for i := 0; i < flaps; i++ {
+		monitor.recordCheck(d, DOWN, 0)
+		monitor.recordCheck(d, UP, 0)
+	}
+
+	waitFor(t, "the hooks to be called", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(transitions) >= 2*flaps
+	})
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i, transition := range transitions {
+		if expected := []string{"UP -> DOWN", "DOWN -> UP"}[i%2]; transition != expected {
+			t.Fatalf("expected transition %d to be %s, got %v", i, expected, transitions)
+		}
+	}
+}
+
+func TestWithDependencyStatusChangeHookFull(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	monitor, _ := newTestMonitor(t, WithDependencyStatusChangeHook(func(name string, from, to DependencyStatus) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}))
+
+	setDependencyStatus(t, monitor, "flapping", UP)
+	monitor.dependenciesMutex.RLock()
+	d := monitor.dependencies["flapping"]
+	monitor.dependenciesMutex.RUnlock()
+
+	// the checks keep being recorded while the hook is blocked, dropping the transitions beyond the queue
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < statusChangeQueueSize*2; i++ {
+			monitor.recordCheck(d, []DependencyStatus{DOWN, UP}[i%2], 0)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the checks not to block on the hook")
+	}
+
+	close(release)
+	waitFor(t, "the queued transitions to be handled", func() bool {
+		return len(monitor.statusChanges) == 0
+	})
+	if got := atomic.LoadInt32(&calls); got > statusChangeQueueSize+1 {
+		t.Errorf("expected at most %d hook calls, got %d", statusChangeQueueSize+1, got)
+	}
+}
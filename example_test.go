@@ -1,13 +1,14 @@
 package gin_monitor_test
 
 import (
-	"log"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	ginMonitor "github.com/bancodobrasil/gin-monitor"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -27,7 +28,7 @@ func YourHandler(w http.ResponseWriter, _ *http.Request) {
 
 func TestMainHandler(t *testing.T) {
 	// Creates gin-monitor instance
-	monitor, err := ginMonitor.New("v1.0.0", ginMonitor.DefaultErrorMessageKey, ginMonitor.DefaultBuckets)
+	monitor, err := ginMonitor.New("v1.0.0", ginMonitor.WithErrorMessageKey(ginMonitor.DefaultErrorMessageKey), ginMonitor.WithBuckets(ginMonitor.DefaultBuckets))
 	if err != nil {
 		panic(err)
 	}
@@ -44,6 +45,45 @@ func TestMainHandler(t *testing.T) {
 	// Routes consist of a path and a handler function.
 	r.GET("/", gin.WrapF(YourHandler))
 
-	// Bind to a port and pass our router in
-	log.Fatal(http.ListenAndServe(":8000", r))
+	// Serve the router and hit it once so the metrics are populated
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, path := range []string{"/", "/metrics"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestFakeDependencyCheckerDown(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	monitor, err := ginMonitor.New("v1.0.0", ginMonitor.WithRegistry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := monitor.AddDependencyChecker(&FakeDependencyChecker{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for monitor.DependencyStatuses()["fake-dependency"] != ginMonitor.DOWN {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the fake dependency to be checked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	labels := prometheus.Labels{"name": "fake-dependency"}
+	if up, err := ginMonitor.GatherValue(registry, "gin_dependency_up", labels); err != nil || up != 0 {
+		t.Errorf("expected gin_dependency_up to be 0, got %v (%v)", up, err)
+	}
+	if status, err := ginMonitor.GatherValue(registry, "dependency_up", labels); err != nil || status != float64(ginMonitor.DOWN) {
+		t.Errorf("expected dependency_up to be %v, got %v (%v)", float64(ginMonitor.DOWN), status, err)
+	}
 }
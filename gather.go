@@ -0,0 +1,71 @@
+package gin_monitor
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// GatherValue gathers the metrics and returns the value of the sample of the named metric having the given labels,
+// which must match exactly one of its samples. Labels the sample has but are not given match any value.
+// Counters, gauges and untyped metrics return their value, while histograms and summaries return their sample count.
+// It is meant for concise assertions in tests.
+func GatherValue(gatherer prometheus.Gatherer, metricName string, labels prometheus.Labels) (float64, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return 0, fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != metricName {
+			continue
+		}
+
+		var matches []*dto.Metric
+		for _, metric := range family.GetMetric() {
+			if hasLabels(metric, labels) {
+				matches = append(matches, metric)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return 0, fmt.Errorf("metric %q has no sample with labels %v", metricName, labels)
+		case 1:
+			return sampleValue(family.GetType(), matches[0]), nil
+		default:
+			return 0, fmt.Errorf("metric %q has %d samples with labels %v, set more labels to select one", metricName, len(matches), labels)
+		}
+	}
+	return 0, fmt.Errorf("metric %q not found", metricName)
+}
+
+// hasLabels reports whether the metric has every given label with the same value
+func hasLabels(metric *dto.Metric, labels prometheus.Labels) bool {
+	matched := 0
+	for _, pair := range metric.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok {
+			if value != pair.GetValue() {
+				return false
+			}
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+// sampleValue returns the value of the sample, or its sample count for histograms and summaries
+func sampleValue(metricType dto.MetricType, metric *dto.Metric) float64 {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		return metric.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		return metric.GetGauge().GetValue()
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return float64(metric.GetHistogram().GetSampleCount())
+	case dto.MetricType_SUMMARY:
+		return float64(metric.GetSummary().GetSampleCount())
+	default:
+		return metric.GetUntyped().GetValue()
+	}
+}
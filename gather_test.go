@@ -0,0 +1,65 @@
+package gin_monitor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGatherValue(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "requests"}, []string{"addr", "method"})
+	requests.WithLabelValues("/users", "GET").Add(3)
+	requests.WithLabelValues("/users", "POST").Add(1)
+	requests.WithLabelValues("/orders", "GET").Add(2)
+
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight", Help: "in flight"})
+	inFlight.Set(5)
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration_seconds", Help: "duration"}, []string{"addr"})
+	duration.WithLabelValues("/users").Observe(0.1)
+	duration.WithLabelValues("/users").Observe(0.2)
+
+	latency := prometheus.NewSummary(prometheus.SummaryOpts{Name: "latency_seconds", Help: "latency"})
+	latency.Observe(0.3)
+
+	registry.MustRegister(requests, inFlight, duration, latency)
+
+	tests := []struct {
+		name    string
+		metric  string
+		labels  prometheus.Labels
+		want    float64
+		wantErr string
+	}{
+		{name: "counter", metric: "requests_total", labels: prometheus.Labels{"addr": "/users", "method": "POST"}, want: 1},
+		{name: "partial labels", metric: "requests_total", labels: prometheus.Labels{"addr": "/orders"}, want: 2},
+		{name: "gauge", metric: "in_flight", want: 5},
+		{name: "histogram count", metric: "duration_seconds", labels: prometheus.Labels{"addr": "/users"}, want: 2},
+		{name: "summary count", metric: "latency_seconds", want: 1},
+		{name: "unknown metric", metric: "missing_total", wantErr: `metric "missing_total" not found`},
+		{name: "unknown label value", metric: "requests_total", labels: prometheus.Labels{"addr": "/missing"}, wantErr: "has no sample"},
+		{name: "unknown label name", metric: "in_flight", labels: prometheus.Labels{"addr": "/users"}, wantErr: "has no sample"},
+		{name: "ambiguous labels", metric: "requests_total", labels: prometheus.Labels{"addr": "/users"}, wantErr: "has 2 samples"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GatherValue(registry, tt.metric, tt.labels)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
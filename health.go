@@ -0,0 +1,65 @@
+package gin_monitor
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthResponse is the body returned by the health handler
+type HealthResponse struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyHealth `json:"dependencies"`
+}
+
+// DependencyHealth is the last known status of a dependency
+type DependencyHealth struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// healthSeverity orders the statuses from the healthiest to the least healthy one
+var healthSeverity = map[DependencyStatus]int{UP: 0, DEGRADED: 1, UNKNOWN: 2, DOWN: 3}
+
+// HealthHandler reports the last known status of every registered dependency checker, without triggering new checks.
+// The overall status is the least healthy one, responding 503 when it is DOWN or UNKNOWN and 200 otherwise.
+func (m *Monitor) HealthHandler() gin.HandlerFunc {
+	return m.healthHandler(anyProbe)
+}
+
+// LivenessHandler reports like HealthHandler, only considering the dependency checkers added with Liveness.
+func (m *Monitor) LivenessHandler() gin.HandlerFunc {
+	return m.healthHandler(livenessProbe)
+}
+
+// ReadinessHandler reports like HealthHandler, only considering the dependency checkers added with Readiness
+// or without any probe option.
+func (m *Monitor) ReadinessHandler() gin.HandlerFunc {
+	return m.healthHandler(readinessProbe)
+}
+
+// healthHandler reports the last known status of the dependencies affecting any of the probes
+func (m *Monitor) healthHandler(probes probe) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := UP
+		statuses := m.dependencyStatuses(probes)
+		dependencies := make([]DependencyHealth, 0, len(statuses))
+		for name, dependencyStatus := range statuses {
+			if healthSeverity[dependencyStatus] > healthSeverity[status] {
+				status = dependencyStatus
+			}
+			dependencies = append(dependencies, DependencyHealth{Name: name, Status: dependencyStatus.String()})
+		}
+
+		sort.Slice(dependencies, func(i, j int) bool {
+			return dependencies[i].Name < dependencies[j].Name
+		})
+
+		statusCode := http.StatusOK
+		if status == DOWN || status == UNKNOWN {
+			statusCode = http.StatusServiceUnavailable
+		}
+		c.JSON(statusCode, HealthResponse{Status: status.String(), Dependencies: dependencies})
+	}
+}
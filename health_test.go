@@ -0,0 +1,176 @@
+package gin_monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		dependencies map[string]DependencyStatus
+		wantCode     int
+		want         HealthResponse
+	}{
+		{
+			name:         "all up",
+			dependencies: map[string]DependencyStatus{"db": UP, "cache": UP},
+			wantCode:     http.StatusOK,
+			want: HealthResponse{Status: "UP", Dependencies: []DependencyHealth{
+				{Name: "cache", Status: "UP"},
+				{Name: "db", Status: "UP"},
+			}},
+		},
+		{
+			name:         "one down",
+			dependencies: map[string]DependencyStatus{"db": UP, "cache": DOWN},
+			wantCode:     http.StatusServiceUnavailable,
+			want: HealthResponse{Status: "DOWN", Dependencies: []DependencyHealth{
+				{Name: "cache", Status: "DOWN"},
+				{Name: "db", Status: "UP"},
+			}},
+		},
+		{
+			name:         "one degraded",
+			dependencies: map[string]DependencyStatus{"db": UP, "cache": DEGRADED},
+			wantCode:     http.StatusOK,
+			want: HealthResponse{Status: "DEGRADED", Dependencies: []DependencyHealth{
+				{Name: "cache", Status: "DEGRADED"},
+				{Name: "db", Status: "UP"},
+			}},
+		},
+		{
+			name:         "one unknown",
+			dependencies: map[string]DependencyStatus{"db": UP, "cache": UNKNOWN},
+			wantCode:     http.StatusServiceUnavailable,
+			want: HealthResponse{Status: "UNKNOWN", Dependencies: []DependencyHealth{
+				{Name: "cache", Status: "UNKNOWN"},
+				{Name: "db", Status: "UP"},
+			}},
+		},
+		{
+			name:         "down prevails over unknown",
+			dependencies: map[string]DependencyStatus{"db": DOWN, "cache": UNKNOWN},
+			wantCode:     http.StatusServiceUnavailable,
+			want: HealthResponse{Status: "DOWN", Dependencies: []DependencyHealth{
+				{Name: "cache", Status: "UNKNOWN"},
+				{Name: "db", Status: "DOWN"},
+			}},
+		},
+		{
+			name:     "no dependencies",
+			wantCode: http.StatusOK,
+			want:     HealthResponse{Status: "UP", Dependencies: []DependencyHealth{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, _ := newTestMonitor(t)
+			for name, status := range tt.dependencies {
+				setDependencyStatus(t, monitor, name, status)
+			}
+
+			r := gin.New()
+			r.GET("/health", monitor.HealthHandler())
+
+			w := serve(r, http.MethodGet, "/health")
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, w.Code)
+			}
+
+			var got HealthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected body %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLivenessAndReadinessHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		checkers      map[*staticChecker][]CheckerOption
+		wantLiveness  int
+		wantReadiness int
+		wantHealth    int
+	}{
+		{
+			name: "liveness dependency down",
+			checkers: map[*staticChecker][]CheckerOption{
+				{name: "deadlock", status: DOWN}: {Liveness},
+				{name: "db", status: UP}:         {Readiness},
+			},
+			wantLiveness:  http.StatusServiceUnavailable,
+			wantReadiness: http.StatusOK,
+			wantHealth:    http.StatusServiceUnavailable,
+		},
+		{
+			name: "readiness dependency down",
+			checkers: map[*staticChecker][]CheckerOption{
+				{name: "deadlock", status: UP}: {Liveness},
+				{name: "db", status: DOWN}:     {Readiness},
+			},
+			wantLiveness:  http.StatusOK,
+			wantReadiness: http.StatusServiceUnavailable,
+			wantHealth:    http.StatusServiceUnavailable,
+		},
+		{
+			name: "unclassified dependency down",
+			checkers: map[*staticChecker][]CheckerOption{
+				{name: "deadlock", status: UP}: {Liveness},
+				{name: "db", status: DOWN}:     nil,
+			},
+			wantLiveness:  http.StatusOK,
+			wantReadiness: http.StatusServiceUnavailable,
+			wantHealth:    http.StatusServiceUnavailable,
+		},
+		{
+			name: "dependency affecting both down",
+			checkers: map[*staticChecker][]CheckerOption{
+				{name: "db", status: DOWN}: {Liveness, Readiness},
+			},
+			wantLiveness:  http.StatusServiceUnavailable,
+			wantReadiness: http.StatusServiceUnavailable,
+			wantHealth:    http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, _ := newTestMonitor(t)
+			for checker, opts := range tt.checkers {
+				if err := monitor.AddDependencyChecker(checker, time.Hour, opts...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			waitFor(t, "the first checks to be recorded", func() bool {
+				for _, status := range monitor.DependencyStatuses() {
+					if status == UNKNOWN {
+						return false
+					}
+				}
+				return true
+			})
+
+			r := gin.New()
+			r.GET("/livez", monitor.LivenessHandler())
+			r.GET("/readyz", monitor.ReadinessHandler())
+			r.GET("/health", monitor.HealthHandler())
+
+			for path, want := range map[string]int{"/livez": tt.wantLiveness, "/readyz": tt.wantReadiness, "/health": tt.wantHealth} {
+				if got := serve(r, http.MethodGet, path).Code; got != want {
+					t.Errorf("%s: expected status %d, got %d", path, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package gin_monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLabelNames returns the label names of the request metrics, in the order their values are collected
+func (cfg config) requestLabelNames() []string {
+	names := []string{"type"}
+	if !cfg.statusClassOnly {
+		names = append(names, "status")
+	}
+	names = append(names, "method", "addr", "isError", "errorMessage")
+	if cfg.statusClassLabel {
+		names = append(names, "status_class")
+	}
+	if cfg.tlsLabel {
+		names = append(names, "tls")
+	}
+	if cfg.userAgentClassifier != nil {
+		names = append(names, "ua_class")
+	}
+	names = append(names, cfg.groupLabels...)
+	for _, label := range cfg.headerLabels {
+		names = append(names, label.name)
+	}
+	return names
+}
+
+// requestLabelValues returns the label values of the request metrics, matching requestLabelNames
+func (m *Monitor) requestLabelValues(c *gin.Context, statusCode int, addr, errorMessage string, groupValues []string) []string {
+	values := []string{c.Request.Proto}
+	if !m.statusClassOnly {
+		values = append(values, strconv.Itoa(statusCode))
+	}
+	values = append(values, c.Request.Method, addr, strconv.FormatBool(m.isErrorLabel(statusCode)), errorMessage)
+	if m.statusClassLabel {
+		values = append(values, statusClass(statusCode))
+	}
+	if m.tlsLabel {
+		values = append(values, strconv.FormatBool(c.Request.TLS != nil))
+	}
+	if m.userAgentClassifier != nil {
+		values = append(values, m.userAgentClassifier(c.Request.UserAgent()))
+	}
+	values = append(values, groupValues...)
+	for _, label := range m.headerLabels {
+		values = append(values, c.Request.Header.Get(label.header))
+	}
+	return validLabelValues(values)
+}
+
+// validLabelValues replaces the invalid UTF-8 sequences of the label values, which the client controls through
+// the request headers and path, so prometheus does not panic on them
+func validLabelValues(values []string) []string {
+	for i, value := range values {
+		values[i] = strings.ToValidUTF8(value, "\uFFFD")
+	}
+	return values
+}
+
+// headerLabel maps a request header to the request metrics label holding its value
+type headerLabel struct {
+	header string
+	name   string
+}
+
+// isErrorLabel reports the isError label value, given by the error status predicate when set
+func (m *Monitor) isErrorLabel(statusCode int) bool {
+	if m.errorStatusPredicate != nil {
+		return m.errorStatusPredicate(statusCode)
+	}
+	return m.IsStatusError(statusCode)
+}
+
+// groupLabelValues returns the values of the group labels, matching the order they were declared
+func (m *Monitor) groupLabelValues(labels gin.H) []string {
+	values := make([]string, len(m.groupLabels))
+	for key, value := range labels {
+		index := -1
+		for i, name := range m.groupLabels {
+			if name == key {
+				index = i
+			}
+		}
+		if index < 0 {
+			panic(fmt.Sprintf("gin-monitor: label %q must be declared with WithGroupLabels", key))
+		}
+		values[index] = fmt.Sprint(value)
+	}
+	return values
+}
+
+// PathRule labels the requests not matching any route whose path matches the pattern with the replacement,
+// e.g. /legacy/123/data with /legacy/:id/data given the pattern ^/legacy/[0-9]+/data$
+type PathRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// routeLabel returns the route template of the request, falling back to the first matching path rule
+// and to the unmatched path label when the request does not match any route
+func (m *Monitor) routeLabel(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	for _, rule := range m.pathRules {
+		if rule.Pattern.MatchString(c.Request.URL.Path) {
+			return rule.Replacement
+		}
+	}
+	return m.unmatchedPath
+}
+
+// addrLabel returns the addr label value, given by the label function when set and falling back to the route otherwise
+func (m *Monitor) addrLabel(c *gin.Context, route string) string {
+	addr := route
+	if m.labelFunc != nil {
+		if label := m.labelFunc(c); label != "" {
+			addr = label
+		}
+	}
+	if m.catchAllCollapse {
+		addr = collapseCatchAll(addr)
+	}
+	if m.pathNormalization {
+		addr = normalizePath(addr)
+	}
+	return addr
+}
+
+// normalizePath lowercases the path and strips its trailing slashes, keeping the root path
+func normalizePath(path string) string {
+	normalized := strings.TrimRight(strings.ToLower(path), "/")
+	if normalized == "" && path != "" {
+		return "/"
+	}
+	return normalized
+}
+
+// collapseCatchAll replaces the first path segment starting with * and the segments after it with *,
+// as a catch-all parameter captures the rest of the path
+func collapseCatchAll(path string) string {
+	if strings.HasPrefix(path, "*") {
+		return "*"
+	}
+	if i := strings.Index(path, "/*"); i >= 0 {
+		return path[:i] + "/*"
+	}
+	return path
+}
+
+// errorLabelNames returns the label names of the request errors metric, in the order their values are collected
+func (cfg config) errorLabelNames() []string {
+	names := []string{"addr", "method", "status"}
+	if cfg.errorLabel {
+		names = append(names, "error")
+	}
+	return names
+}
+
+// errorLabelValues returns the label values of the request errors metric, matching errorLabelNames
+func (m *Monitor) errorLabelValues(c *gin.Context, statusCode int, addr string) []string {
+	values := []string{addr, c.Request.Method, strconv.Itoa(statusCode)}
+	if m.errorLabel {
+		values = append(values, m.errorMessage(c))
+	}
+	return validLabelValues(values)
+}
+
+// errorMessage returns the error message stored in the context under the error message key,
+// falling back to the last error attached with c.Error, with its whitespace collapsed and truncated to the error label max length
+func (m *Monitor) errorMessage(c *gin.Context) string {
+	var message string
+	if value, ok := c.Get(m.errorMessageKey); ok && value != nil {
+		switch v := value.(type) {
+		case string:
+			message = v
+		case error:
+			message = v.Error()
+		default:
+			message = fmt.Sprint(v)
+		}
+	} else {
+		for i := len(c.Errors) - 1; i >= 0; i-- {
+			if c.Errors[i] != nil && c.Errors[i].Err != nil {
+				message = c.Errors[i].Err.Error()
+				break
+			}
+		}
+	}
+
+	message = strings.Join(strings.Fields(strings.ToValidUTF8(message, "\uFFFD")), " ")
+	if runes := []rune(message); len(runes) > m.errorLabelMaxLength {
+		message = string(runes[:m.errorLabelMaxLength])
+	}
+	return message
+}
+
+// statusClass groups the status code into its class, e.g. 404 into 4xx
+func statusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
@@ -0,0 +1,418 @@
+package gin_monitor
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStatusClass(t *testing.T) {
+	tests := map[int]string{
+		99:  "unknown",
+		100: "1xx",
+		199: "1xx",
+		200: "2xx",
+		299: "2xx",
+		300: "3xx",
+		404: "4xx",
+		500: "5xx",
+		599: "5xx",
+		600: "unknown",
+	}
+
+	for code, want := range tests {
+		if got := statusClass(code); got != want {
+			t.Errorf("statusClass(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestPrometheusStatusClassLabel(t *testing.T) {
+	tests := []struct {
+		name       string
+		opt        Option
+		wantStatus []string
+		wantClass  []string
+	}{
+		{name: "alongside status", opt: WithStatusClassLabel(), wantStatus: []string{"200", "299", "500"}, wantClass: []string{"2xx", "2xx", "5xx"}},
+		{name: "instead of status", opt: WithStatusClassOnly(), wantClass: []string{"2xx", "5xx"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, tt.opt)
+
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			r.GET("/status/:code", func(c *gin.Context) {
+				code := map[string]int{"200": 200, "299": 299, "500": 500}[c.Param("code")]
+				c.Status(code)
+			})
+
+			for _, code := range []string{"200", "299", "500"} {
+				serve(r, http.MethodGet, "/status/"+code)
+			}
+
+			family := findFamily(t, registry, "request_seconds")
+			if family == nil {
+				t.Fatal("expected request_seconds to have samples")
+			}
+			if got := labelValues(family, "status_class"); !reflect.DeepEqual(got, tt.wantClass) {
+				t.Errorf("expected status_class labels %v, got %v", tt.wantClass, got)
+			}
+			if got := labelValues(family, "status"); !reflect.DeepEqual(got, tt.wantStatus) {
+				t.Errorf("expected status labels %v, got %v", tt.wantStatus, got)
+			}
+		})
+	}
+}
+
+func TestPrometheusWithLabels(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithGroupLabels("group"))
+
+	r := gin.New()
+	billing := r.Group("/billing", monitor.PrometheusWithLabels(gin.H{"group": "billing"}))
+	billing.GET("/invoices", func(c *gin.Context) { c.Status(http.StatusOK) })
+	users := r.Group("/users", monitor.PrometheusWithLabels(gin.H{"group": "users"}))
+	users.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/ping", monitor.Prometheus(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve(r, http.MethodGet, "/billing/invoices")
+	serve(r, http.MethodGet, "/users/")
+	serve(r, http.MethodGet, "/ping")
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := labelValues(family, "group"); !reflect.DeepEqual(got, []string{"", "billing", "users"}) {
+		t.Errorf("expected group labels [ billing users], got %v", got)
+	}
+}
+
+func TestPrometheusWithUndeclaredLabels(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected an undeclared label to panic")
+		}
+	}()
+	monitor.PrometheusWithLabels(gin.H{"group": "billing"})
+}
+
+func TestPrometheusWithLabelFunc(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithLabelFunc(func(c *gin.Context) string {
+		return c.GetString("route-name")
+	}))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.Use(func(c *gin.Context) {
+		if c.FullPath() == "/users/:id" {
+			c.Set("route-name", "get-user")
+		}
+	})
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve(r, http.MethodGet, "/users/1")
+	serve(r, http.MethodGet, "/ping")
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := labelValues(family, "addr"); !reflect.DeepEqual(got, []string{"/ping", "get-user"}) {
+		t.Errorf("expected the label func value and the route fallback, got %v", got)
+	}
+}
+
+func TestPrometheusHeaderLabels(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithHeaderLabels(map[string]string{"X-Tenant-ID": "tenant", "X-Region": "region"}))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, tenant := range []string{"acme", "globex", "acme", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant-ID", tenant)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := labelValues(family, "tenant"); !reflect.DeepEqual(got, []string{"", "acme", "globex"}) {
+		t.Errorf("expected one series per tenant, got %v", got)
+	}
+	if got := labelValues(family, "region"); !reflect.DeepEqual(got, []string{"", "", ""}) {
+		t.Errorf("expected missing headers to record empty values, got %v", got)
+	}
+	// the label names are sorted, so the dimensions do not depend on the map iteration order
+	if got := monitor.requestLabelNames(); !reflect.DeepEqual(got[len(got)-2:], []string{"region", "tenant"}) {
+		t.Errorf("expected the header labels last, got %v", got)
+	}
+}
+
+func TestPrometheusInvalidHeaderLabel(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithHeaderLabels(map[string]string{"X-Tenant-ID": "tenant"}))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("X-Tenant-ID", "acme\xff\xfe")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected an invalid header not to fail the request, got status %d", w.Code)
+	}
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := labelValues(family, "tenant"); !reflect.DeepEqual(got, []string{"acme\uFFFD"}) {
+		t.Errorf("expected the invalid bytes to be replaced, got %q", got)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := map[string]string{
+		"/":            "/",
+		"//":           "/",
+		"":             "",
+		"/users":       "/users",
+		"/Users/":      "/users",
+		"/users//":     "/users",
+		"/Users/:ID":   "/users/:id",
+		UnmatchedPath:  UnmatchedPath,
+		"/api/V1/Faq/": "/api/v1/faq",
+	}
+
+	for path, want := range tests {
+		if got := normalizePath(path); got != want {
+			t.Errorf("normalizePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestPrometheusPathNormalization(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{name: "disabled", want: []string{"/", "/Users", "/Users/", "/users", "/users/"}},
+		{name: "enabled", opts: []Option{WithPathNormalization()}, want: []string{"/", "/users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// label the requests by their raw path, since gin routes are case and slash sensitive
+			opts := append([]Option{WithLabelFunc(func(c *gin.Context) string { return c.Request.URL.Path })}, tt.opts...)
+			monitor, registry := newTestMonitor(t, opts...)
+
+			r := gin.New()
+			r.RedirectTrailingSlash = false
+			r.Use(monitor.Prometheus())
+			for _, path := range []string{"/", "/users", "/users/", "/Users", "/Users/"} {
+				r.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+				serve(r, http.MethodGet, path)
+			}
+
+			family := findFamily(t, registry, "request_seconds")
+			if family == nil {
+				t.Fatal("expected request_seconds to have samples")
+			}
+			if got := labelValues(family, "addr"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected series %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCollapseCatchAll(t *testing.T) {
+	tests := map[string]string{
+		"/":                   "/",
+		"":                    "",
+		"/users/:id":          "/users/:id",
+		"/files/*filepath":    "/files/*",
+		"/files/*a/b/c":       "/files/*",
+		"/files/*x":           "/files/*",
+		"/*filepath":          "/*",
+		"*filepath":           "*",
+		"/a/*first/b/*second": "/a/*",
+		"/static/*":           "/static/*",
+		"/users/:id/*":        "/users/:id/*",
+		"/users/:id/*action/": "/users/:id/*",
+		UnmatchedPath:         UnmatchedPath,
+	}
+
+	for path, want := range tests {
+		if got := collapseCatchAll(path); got != want {
+			t.Errorf("collapseCatchAll(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestPrometheusCatchAllCollapse(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{name: "disabled", want: []string{"/files/*a/b/c", "/files/*x"}},
+		{name: "enabled", opts: []Option{WithCatchAllCollapse()}, want: []string{"/files/*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// label the requests as the gin versions leaking the captured value into the route do
+			opts := append([]Option{WithLabelFunc(func(c *gin.Context) string {
+				return "/files/*" + strings.TrimPrefix(c.Param("filepath"), "/")
+			})}, tt.opts...)
+			monitor, registry := newTestMonitor(t, opts...)
+
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			r.GET("/files/*filepath", func(c *gin.Context) { c.Status(http.StatusOK) })
+			serve(r, http.MethodGet, "/files/a/b/c")
+			serve(r, http.MethodGet, "/files/x")
+
+			family := findFamily(t, registry, "request_seconds")
+			if family == nil {
+				t.Fatal("expected request_seconds to have samples")
+			}
+			if got := labelValues(family, "addr"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected series %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPrometheusPathRules(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithPathRules([]PathRule{
+		{Pattern: regexp.MustCompile(`^/legacy/[0-9]+/data$`), Replacement: "/legacy/:id/data"},
+		// shadowed by the rule above for the paths both match, since the first matching rule wins
+		{Pattern: regexp.MustCompile(`^/legacy/`), Replacement: "/legacy/*"},
+	}))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/legacy/123/data", "/legacy/456/data", "/legacy/abc/data", "/other", "/users/1"} {
+		serve(r, http.MethodGet, path)
+	}
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	want := []string{"/legacy/*", "/legacy/:id/data", "/users/:id", UnmatchedPath}
+	if got := labelValues(family, "addr"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected series %v, got %v", want, got)
+	}
+	if got, err := GatherValue(registry, "gin_requests_total", prometheus.Labels{"addr": "/legacy/:id/data"}); err != nil || got != 2 {
+		t.Errorf("expected 2 requests labeled by the first rule, got %v (%v)", got, err)
+	}
+}
+
+func TestPrometheusTLSLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{name: "disabled"},
+		{name: "enabled", opts: []Option{WithTLSLabel()}, want: []string{"false", "true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, tt.opts...)
+
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			plaintext := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			encrypted := httptest.NewRequest(http.MethodGet, "https://example.com/ping", nil)
+			if encrypted.TLS == nil {
+				encrypted.TLS = &tls.ConnectionState{}
+			}
+			for _, req := range []*http.Request{plaintext, encrypted} {
+				r.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			family := findFamily(t, registry, "request_seconds")
+			if family == nil {
+				t.Fatal("expected request_seconds to have samples")
+			}
+			if got := labelValues(family, "tls"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected tls labels %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithUnmatchedPathLabel(t *testing.T) {
+	monitor, registry := newTestMonitor(t,
+		WithUnmatchedPathLabel("__unknown__"),
+		WithPathRules([]PathRule{{Pattern: regexp.MustCompile(`^/legacy/`), Replacement: "/legacy/*"}}))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	if w := serve(r, http.MethodGet, "/missing"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	serve(r, http.MethodGet, "/legacy/1")
+
+	if got, err := GatherValue(registry, "gin_requests_total", prometheus.Labels{"addr": "__unknown__", "status": "404"}); err != nil || got != 1 {
+		t.Errorf("expected the 404 request to be labeled __unknown__, got %v (%v)", got, err)
+	}
+	if got := labelValues(findFamily(t, registry, "request_seconds"), "addr"); !reflect.DeepEqual(got, []string{"/legacy/*", "__unknown__"}) {
+		t.Errorf("expected the path rules to take precedence, got %v", got)
+	}
+}
+
+func TestWithUserAgentClassifier(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithUserAgentClassifier(func(userAgent string) string {
+		if strings.Contains(userAgent, "Googlebot") {
+			return "bot"
+		}
+		return "other"
+	}))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, userAgent := range []string{"Mozilla/5.0 (compatible; Googlebot/2.1)", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("User-Agent", userAgent)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for class, want := range map[string]float64{"bot": 1, "other": 2} {
+		if got, err := GatherValue(registry, "gin_requests_total", prometheus.Labels{"ua_class": class}); err != nil || got != want {
+			t.Errorf("%s: expected %v requests, got %v (%v)", class, want, got, err)
+		}
+	}
+}
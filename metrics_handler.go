@@ -0,0 +1,123 @@
+package gin_monitor
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsHandlerOption configures the handler returned by MetricsHandler.
+type MetricsHandlerOption func(*metricsHandlerConfig)
+
+type metricsHandlerConfig struct {
+	username        string
+	password        string
+	basicAuth       bool
+	allowedNetworks []*net.IPNet
+	forwardedIP     bool
+	handlerOpts     promhttp.HandlerOpts
+}
+
+// WithBasicAuth requires the requests to the metrics handler to authenticate with the basic auth credentials,
+// responding 401 otherwise.
+func WithBasicAuth(username, password string) MetricsHandlerOption {
+	return func(cfg *metricsHandlerConfig) {
+		cfg.username = username
+		cfg.password = password
+		cfg.basicAuth = true
+	}
+}
+
+// WithAllowedNetworks only serves the metrics to the clients whose IP, the remote address of the connection
+// unless WithForwardedClientIP is set, is in any of the networks, responding 403 otherwise.
+func WithAllowedNetworks(networks ...*net.IPNet) MetricsHandlerOption {
+	return func(cfg *metricsHandlerConfig) {
+		cfg.allowedNetworks = append(cfg.allowedNetworks, networks...)
+	}
+}
+
+// WithForwardedClientIP matches the networks set by WithAllowedNetworks against the client IP given by
+// gin.Context.ClientIP, which is read from the forwarding headers sent by the trusted proxies.
+// The engine must only trust the proxies in front of it, as set by gin.Engine.SetTrustedProxies,
+// or the clients can spoof their IP through those headers.
+func WithForwardedClientIP() MetricsHandlerOption {
+	return func(cfg *metricsHandlerConfig) {
+		cfg.forwardedIP = true
+	}
+}
+
+// WithHandlerOpts sets the options of the promhttp handler serving the metrics,
+// such as EnableOpenMetrics to expose the exemplars.
+func WithHandlerOpts(opts promhttp.HandlerOpts) MetricsHandlerOption {
+	return func(cfg *metricsHandlerConfig) {
+		cfg.handlerOpts = opts
+	}
+}
+
+// MetricsHandler serves the metrics of the registry the monitor was registered with.
+// Requests from clients outside the networks set by WithAllowedNetworks are rejected with 403
+// and requests not matching the credentials set by WithBasicAuth with 401, any request being served otherwise.
+// It responds 500 if the registerer given to WithRegistry is not a prometheus.Gatherer.
+func (m *Monitor) MetricsHandler(opts ...MetricsHandlerOption) gin.HandlerFunc {
+	cfg := metricsHandlerConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	gatherer := m.Registry()
+	if gatherer == nil {
+		return func(c *gin.Context) {
+			c.String(http.StatusInternalServerError, "the registerer given to WithRegistry is not a prometheus.Gatherer")
+		}
+	}
+	handler := promhttp.HandlerFor(gatherer, cfg.handlerOpts)
+
+	return func(c *gin.Context) {
+		if len(cfg.allowedNetworks) > 0 && !cfg.allows(cfg.clientIP(c)) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if cfg.basicAuth && !cfg.authenticates(c.Request) {
+			c.Header("WWW-Authenticate", `Basic realm="metrics"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// clientIP returns the IP matched against the allowed networks
+func (cfg metricsHandlerConfig) clientIP(c *gin.Context) net.IP {
+	if cfg.forwardedIP {
+		return net.ParseIP(c.ClientIP())
+	}
+	ip, _ := c.RemoteIP()
+	return ip
+}
+
+// allows reports whether the client IP is in any of the allowed networks
+func (cfg metricsHandlerConfig) allows(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range cfg.allowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticates reports whether the request has the basic auth credentials, comparing them in constant time
+func (cfg metricsHandlerConfig) authenticates(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.username)) == 1
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(cfg.password)) == 1
+	return usernameMatch && passwordMatch
+}
@@ -0,0 +1,144 @@
+package gin_monitor
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	_, allowed, _ := net.ParseCIDR("192.0.2.0/24")
+	_, other, _ := net.ParseCIDR("198.51.100.0/24")
+
+	tests := []struct {
+		name       string
+		opts       []MetricsHandlerOption
+		remoteAddr string
+		forwarded  string
+		auth       bool
+		username   string
+		password   string
+		wantCode   int
+	}{
+		{name: "no auth", remoteAddr: "203.0.113.1:1234", wantCode: http.StatusOK},
+		{
+			name:     "authorized",
+			opts:     []MetricsHandlerOption{WithBasicAuth("prometheus", "secret")},
+			auth:     true,
+			username: "prometheus",
+			password: "secret",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "wrong password",
+			opts:     []MetricsHandlerOption{WithBasicAuth("prometheus", "secret")},
+			auth:     true,
+			username: "prometheus",
+			password: "guess",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "missing credentials",
+			opts:     []MetricsHandlerOption{WithBasicAuth("prometheus", "secret")},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "allowed ip",
+			opts:       []MetricsHandlerOption{WithAllowedNetworks(other, allowed)},
+			remoteAddr: "192.0.2.10:1234",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "disallowed ip",
+			opts:       []MetricsHandlerOption{WithAllowedNetworks(allowed)},
+			remoteAddr: "198.51.100.10:1234",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "spoofed forwarded ip",
+			opts:       []MetricsHandlerOption{WithAllowedNetworks(allowed)},
+			remoteAddr: "203.0.113.1:1234",
+			forwarded:  "192.0.2.10",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "forwarded ip",
+			opts:       []MetricsHandlerOption{WithAllowedNetworks(allowed), WithForwardedClientIP()},
+			remoteAddr: "203.0.113.1:1234",
+			forwarded:  "192.0.2.10",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "disallowed forwarded ip",
+			opts:       []MetricsHandlerOption{WithAllowedNetworks(allowed), WithForwardedClientIP()},
+			remoteAddr: "192.0.2.10:1234",
+			forwarded:  "198.51.100.10",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "disallowed ip with credentials",
+			opts:       []MetricsHandlerOption{WithAllowedNetworks(allowed), WithBasicAuth("prometheus", "secret")},
+			remoteAddr: "198.51.100.10:1234",
+			auth:       true,
+			username:   "prometheus",
+			password:   "secret",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "allowed ip without credentials",
+			opts:       []MetricsHandlerOption{WithAllowedNetworks(allowed), WithBasicAuth("prometheus", "secret")},
+			remoteAddr: "192.0.2.10:1234",
+			wantCode:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, _ := newTestMonitor(t)
+			r := gin.New()
+			r.GET("/metrics", monitor.MetricsHandler(tt.opts...))
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.auth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			served := strings.Contains(w.Body.String(), "gin_build_info")
+			if served != (tt.wantCode == http.StatusOK) {
+				t.Errorf("expected the metrics to be served only with status 200, got %d serving them: %v", w.Code, served)
+			}
+			if tt.wantCode == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerWithoutGatherer(t *testing.T) {
+	monitor, err := New("v1.0.0", WithRegistry(registererOnly{prometheus.NewRegistry()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.GET("/metrics", monitor.MetricsHandler())
+	if w := serve(r, http.MethodGet, "/metrics"); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+}
@@ -1,99 +1,467 @@
 package gin_monitor
 
 import (
+	"context"
 	"errors"
-	"strconv"
+	"fmt"
+	"net/http"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type Monitor struct {
+	config
 	reqDuration           *prometheus.HistogramVec
+	requestsTotal         *prometheus.CounterVec
+	latencySummary        *prometheus.SummaryVec
 	dependencyReqDuration *prometheus.HistogramVec
 	respSize              *prometheus.CounterVec
+	reqSizeBytes          *prometheus.HistogramVec
+	respSizeBytes         *prometheus.HistogramVec
+	inFlight              *prometheus.GaugeVec
+	panicsRecovered       *prometheus.CounterVec
+	slowRequests          *prometheus.CounterVec
+	timeToFirstByte       *prometheus.HistogramVec
+	handlerDuration       *prometheus.HistogramVec
+	requestErrors         *prometheus.CounterVec
 	dependencyUP          *prometheus.GaugeVec
+	dependencyIsUp        *prometheus.GaugeVec
+	dependencyCheckTime   *prometheus.HistogramVec
+	dependencyLastCheck   *prometheus.GaugeVec
+	dependencyCheckPanics *prometheus.CounterVec
+	checkersActive        prometheus.Gauge
+	dependencyInterval    *prometheus.GaugeVec
 	applicationInfo       *prometheus.GaugeVec
-	errorMessageKey       string
+	buildInfo             *prometheus.GaugeVec
+	otelRequests          metric.Int64Counter
+	otelDuration          metric.Float64Histogram
 	IsStatusError         func(statusCode int) bool
-}
 
-// DependencyStatus is the type to represent UP or DOWN states
-type DependencyStatus int
+	routeDurationsMutex sync.RWMutex
+	routeDurations      map[string]*prometheus.HistogramVec
 
-// DependencyChecker specifies the methods a checker must implement.
-type DependencyChecker interface {
-	GetDependencyName() string
-	Check() DependencyStatus
-}
+	dependenciesMutex sync.RWMutex
+	dependencies      map[string]*dependency
+	schedulers        map[time.Duration]*checkScheduler
+	// statusChanges queues the status transitions for the status change hook, in the order they were recorded
+	statusChanges chan statusChange
 
-const (
-	DOWN DependencyStatus = iota
-	UP
-)
+	checkers sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// inFlightRequests mirrors the in-flight gauge across every method, for WaitForInFlight
+	inFlightRequests atomic.Int64
+}
 
 const DefaultErrorMessageKey = "error-message"
 
+// DefaultErrorLabelMaxLength is how many characters of the error message the error label keeps by default
+const DefaultErrorLabelMaxLength = 64
+
+// SkipDurationKey is the context key a handler sets to true, e.g. with c.Set(SkipDurationKey, true),
+// so the request is counted without observing its duration, which is meaningless for streamed responses
+const SkipDurationKey = "gin_monitor_skip_duration"
+
+// handlerDurationKey is the context key HandlerTimer sets to the duration of the handlers following it
+const handlerDurationKey = "gin_monitor_handler_duration"
+
+// UnmatchedPath is the addr label value of requests that do not match any route, unless set by WithUnmatchedPathLabel
+const UnmatchedPath = "<unmatched>"
+
 var (
-	DefaultBuckets = []float64{0.1, 0.3, 1.5, 10.5}
+	DefaultBuckets     = []float64{0.1, 0.3, 1.5, 10.5}
+	DefaultSizeBuckets = prometheus.ExponentialBuckets(64, 4, 8)
+
+	DefaultDependencyCheckBuckets = prometheus.DefBuckets
+
+	// DefaultLatencyObjectives are the quantiles of the latency summary, mapped to their absolute error
+	DefaultLatencyObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
 )
 
-//New create new Monitor instance
-func New(applicationVersion string, errorMessageKey string, buckets []float64) (*Monitor, error) {
+// New create new Monitor instance
+func New(applicationVersion string, opts ...Option) (*Monitor, error) {
 	if strings.TrimSpace(applicationVersion) == "" {
 		return nil, errors.New("application version must be a non-empty string")
 	}
 
-	if strings.TrimSpace(applicationVersion) == "" {
-		errorMessageKey = DefaultErrorMessageKey
-	}
+	cfg := newConfig(opts...)
+	requestLabels := cfg.requestLabelNames()
 
-	if buckets == nil {
-		buckets = DefaultBuckets
+	monitor := &Monitor{
+		config:         cfg,
+		IsStatusError:  IsStatusError,
+		dependencies:   map[string]*dependency{},
+		schedulers:     map[time.Duration]*checkScheduler{},
+		routeDurations: map[string]*prometheus.HistogramVec{},
 	}
+	monitor.ctx, monitor.cancel = context.WithCancel(context.Background())
+
+	monitor.reqDuration = cfg.newRequestDuration(cfg.buckets)
+
+	monitor.requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "requests_total",
+		Help:        "Counts the HTTP requests",
+	}, requestLabels)
 
-	monitor := &Monitor{errorMessageKey: errorMessageKey, IsStatusError: IsStatusError}
+	monitor.respSize = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "response_size_bytes",
+		Help:        "Counts the size of each HTTP response",
+	}, requestLabels)
 
-	monitor.reqDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "request_seconds",
-		Help:    "Duration in seconds of HTTP requests.",
-		Buckets: buckets,
-	}, []string{"type", "status", "method", "addr", "isError", "errorMessage"})
+	monitor.reqSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "request_size_bytes",
+		Help:        "Size in bytes of HTTP request bodies.",
+		Buckets:     cfg.sizeBuckets,
+	}, requestLabels)
 
-	monitor.respSize = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "response_size_bytes",
-		Help: "Counts the size of each HTTP response",
-	}, []string{"type", "status", "method", "addr", "isError", "errorMessage"})
+	// keeps the gin prefix within its name, which the response_size_bytes metric would collide with under a custom namespace
+	monitor.respSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "gin_response_size_bytes",
+		Help:        "Size in bytes of HTTP response bodies.",
+		Buckets:     cfg.sizeBuckets,
+	}, requestLabels)
 
-	monitor.dependencyUP = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "dependency_up",
-		Help: "Records if a dependency is up or down. 1 for up, 0 for down",
+	monitor.inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "in_flight_requests",
+		Help:        "Number of HTTP requests currently being processed",
+	}, []string{"method"})
+
+	monitor.panicsRecovered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "panics_recovered_total",
+		Help:        "Counts the panics recovered from HTTP handlers",
+	}, []string{"addr", "method"})
+
+	monitor.requestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "request_errors_total",
+		Help:        "Counts the HTTP requests responded with an error status",
+	}, cfg.errorLabelNames())
+
+	monitor.dependencyUP = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "dependency_up",
+		Help:        "Records if a dependency is up or down. 1 for up, 0 for down, 2 for degraded, 3 for unknown",
+	}, []string{"name"})
+
+	// keeps the gin prefix within its name, which the dependency_up metric would collide with under a custom namespace
+	monitor.dependencyIsUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "gin_dependency_up",
+		Help:        "Records if a dependency is up. 1 for up, 0 otherwise",
+	}, []string{"name"})
+
+	monitor.dependencyCheckTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "dependency_check_duration_seconds",
+		Help:        "Duration of dependency checks in seconds.",
+		Buckets:     cfg.dependencyCheckBuckets,
 	}, []string{"name"})
 
-	monitor.dependencyReqDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "dependency_request_seconds",
-		Help:    "Duration of dependency requests in seconds.",
-		Buckets: buckets,
+	monitor.dependencyLastCheck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "dependency_last_check_timestamp_seconds",
+		Help:        "Unix timestamp of the last completed dependency check.",
+	}, []string{"name"})
+
+	monitor.dependencyCheckPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "dependency_check_panics_total",
+		Help:        "Counts the panics recovered from dependency checks",
+	}, []string{"name"})
+
+	monitor.checkersActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "dependency_checkers_active",
+		Help:        "Number of dependency checkers currently scheduled",
+	})
+
+	monitor.dependencyInterval = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "dependency_check_interval_seconds",
+		Help:        "Checking period in seconds of dependency checkers.",
+	}, []string{"name"})
+
+	monitor.dependencyReqDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "dependency_request_seconds",
+		Help:        "Duration of dependency requests in seconds.",
+		Buckets:     cfg.buckets,
 	}, []string{"name", "type", "status", "method", "addr", "isError", "errorMessage"})
 
-	monitor.applicationInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "application_info",
-		Help: "Static information about the application",
+	monitor.handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "handler_duration_seconds",
+		Help:        "Duration in seconds of the handlers following the HandlerTimer middleware.",
+		Buckets:     cfg.buckets,
+	}, requestLabels)
+
+	monitor.applicationInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "application_info",
+		Help:        "Static information about the application",
 	}, []string{"version"})
 	monitor.applicationInfo.WithLabelValues(applicationVersion).Set(1)
 
+	monitor.buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   cfg.ginNamespace(),
+		Subsystem:   cfg.subsystem,
+		ConstLabels: cfg.constLabels,
+		Name:        "build_info",
+		Help:        "Build information about the application, always 1",
+	}, []string{"version", "goversion", "commit"})
+	monitor.buildInfo.WithLabelValues(applicationVersion, runtime.Version(), cfg.commit).Set(1)
+
+	collectors := []prometheus.Collector{
+		monitor.requestsTotal,
+		monitor.respSize,
+		monitor.reqSizeBytes,
+		monitor.respSizeBytes,
+		monitor.inFlight,
+		monitor.panicsRecovered,
+		monitor.requestErrors,
+		monitor.handlerDuration,
+		monitor.dependencyUP,
+		monitor.dependencyIsUp,
+		monitor.dependencyCheckTime,
+		monitor.dependencyLastCheck,
+		monitor.dependencyCheckPanics,
+		monitor.checkersActive,
+		monitor.dependencyInterval,
+		monitor.dependencyReqDuration,
+		monitor.applicationInfo,
+		monitor.buildInfo,
+	}
+
+	if !cfg.latencySummaryOnly {
+		collectors = append(collectors, &requestDurationCollector{monitor})
+	}
+
+	if cfg.latencyObjectives != nil {
+		monitor.latencySummary = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:   cfg.ginNamespace(),
+			Subsystem:   cfg.subsystem,
+			ConstLabels: cfg.constLabels,
+			Name:        "request_duration_summary_seconds",
+			Help:        "Duration in seconds of HTTP requests.",
+			Objectives:  cfg.latencyObjectives,
+		}, requestLabels)
+		collectors = append(collectors, monitor.latencySummary)
+	}
+
+	if cfg.slowRequestThreshold > 0 {
+		monitor.slowRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.ginNamespace(),
+			Subsystem:   cfg.subsystem,
+			ConstLabels: cfg.constLabels,
+			Name:        "slow_requests_total",
+			Help:        "Counts the HTTP requests slower than the configured threshold",
+		}, []string{"addr", "method"})
+		collectors = append(collectors, monitor.slowRequests)
+	}
+
+	if cfg.timeToFirstByte {
+		monitor.timeToFirstByte = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   cfg.ginNamespace(),
+			Subsystem:   cfg.subsystem,
+			ConstLabels: cfg.constLabels,
+			Name:        "request_ttfb_seconds",
+			Help:        "Duration in seconds from the start of HTTP requests to the first write of their response.",
+			Buckets:     cfg.buckets,
+		}, requestLabels)
+		collectors = append(collectors, monitor.timeToFirstByte)
+	}
+
+	if cfg.meterProvider != nil {
+		if err := monitor.newOtelInstruments(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := register(cfg.registerer, collectors...); err != nil {
+		return nil, err
+	}
+
+	if cfg.statusChangeHook != nil {
+		monitor.statusChanges = make(chan statusChange, statusChangeQueueSize)
+		monitor.checkers.Add(1)
+		go monitor.runStatusChangeHook()
+	}
+
 	return monitor, nil
 }
 
-func (m *Monitor) collectTime(reqType, status, method, addr, isError, errorMessage string, durationSeconds float64) {
-	m.reqDuration.WithLabelValues(reqType, status, method, addr, isError, errorMessage).Observe(durationSeconds)
+// register registers every collector, rolling back the ones already registered if any of them fails
+func register(registerer prometheus.Registerer, collectors ...prometheus.Collector) error {
+	for i, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			for _, registered := range collectors[:i] {
+				registerer.Unregister(registered)
+			}
+			var alreadyRegistered prometheus.AlreadyRegisteredError
+			if errors.As(err, &alreadyRegistered) {
+				return fmt.Errorf("metrics already registered, use WithRegistry to register another monitor: %w", err)
+			}
+			return fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// Registry returns the gatherer of the registry the metrics were registered with,
+// or nil if the registerer given to WithRegistry is not a prometheus.Gatherer.
+func (m *Monitor) Registry() prometheus.Gatherer {
+	gatherer, _ := m.registerer.(prometheus.Gatherer)
+	return gatherer
+}
+
+// RequestsCounter returns the gin_requests_total counter the middleware records the requests in.
+// Its labels are ordered as returned by RequestLabelNames: type, status, method, addr, isError and errorMessage,
+// followed by the optional status_class, tls and ua_class labels, the group labels and the header labels.
+// The status label is left out by WithStatusClassOnly.
+func (m *Monitor) RequestsCounter() *prometheus.CounterVec {
+	return m.requestsTotal
 }
 
-func (m *Monitor) collectSize(reqType, status, method, addr, isError, errorMessage string, size float64) {
-	m.respSize.WithLabelValues(reqType, status, method, addr, isError, errorMessage).Add(size)
+// RequestDuration returns the request_seconds histogram the middleware observes the request durations in,
+// with the labels of RequestsCounter. Routes given their own buckets by SetRouteBuckets are observed in separate histograms,
+// so observations must not be made with their addr label values, and the histogram is not registered with WithLatencySummaryOnly.
+func (m *Monitor) RequestDuration() *prometheus.HistogramVec {
+	return m.reqDuration
+}
+
+// RequestLabelNames returns the label names of the request metrics, in the order their values must be given.
+func (m *Monitor) RequestLabelNames() []string {
+	return m.requestLabelNames()
+}
+
+// NewLegacy create new Monitor instance using the former positional arguments.
+//
+// Deprecated: use New with WithErrorMessageKey and WithBuckets instead.
+func NewLegacy(applicationVersion string, errorMessageKey string, buckets []float64) (*Monitor, error) {
+	return New(applicationVersion, WithErrorMessageKey(errorMessageKey), WithBuckets(buckets))
+}
+
+func (m *Monitor) collectTime(c *gin.Context, addr string, labels []string, durationSeconds float64) {
+	if m.latencySummary != nil {
+		m.latencySummary.WithLabelValues(labels...).Observe(durationSeconds)
+	}
+	if m.latencySummaryOnly {
+		return
+	}
+
+	m.routeDurationsMutex.RLock()
+	defer m.routeDurationsMutex.RUnlock()
+
+	// the per-route histograms are keyed by the addr label value, so no two of them collect the same series
+	histogram, ok := m.routeDurations[addr]
+	if !ok {
+		histogram = m.reqDuration
+	}
+	observer := histogram.WithLabelValues(labels...)
+
+	if m.exemplarExtractor != nil {
+		if exemplar, ok := m.exemplarExtractor(c); ok && validExemplar(exemplar) {
+			observer.(prometheus.ExemplarObserver).ObserveWithExemplar(durationSeconds, exemplar)
+			return
+		}
+	}
+	observer.Observe(durationSeconds)
+}
+
+// validExemplar reports whether prometheus accepts the exemplar labels, which must have valid names and UTF-8 values
+// within ExemplarMaxRunes, since observing an invalid exemplar panics
+func validExemplar(labels prometheus.Labels) bool {
+	runes := 0
+	for name, value := range labels {
+		if !model.LabelName(name).IsValid() || !utf8.ValidString(value) {
+			return false
+		}
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	return runes <= prometheus.ExemplarMaxRunes
+}
+
+func (m *Monitor) collectSize(labels []string, size float64) {
+	m.respSize.WithLabelValues(labels...).Add(size)
+}
+
+// collectBodySizes observes the request and response body sizes, skipping unknown request lengths
+func (m *Monitor) collectBodySizes(c *gin.Context, labels []string) {
+	if c.Request.ContentLength >= 0 {
+		m.reqSizeBytes.WithLabelValues(labels...).Observe(float64(c.Request.ContentLength))
+	}
+
+	size := c.Writer.Size()
+	if size < 0 {
+		size = 0
+	}
+	m.respSizeBytes.WithLabelValues(labels...).Observe(float64(size))
+}
+
+// collectError counts the requests responded with a status in the error range, labeled by their error message
+func (m *Monitor) collectError(c *gin.Context, statusCode int, addr string) {
+	if !m.isErrorStatus(statusCode) {
+		return
+	}
+	m.requestErrors.WithLabelValues(m.errorLabelValues(c, statusCode, addr)...).Inc()
+}
+
+// isErrorStatus reports whether the status code is counted by the request errors metric
+func (m *Monitor) isErrorStatus(statusCode int) bool {
+	if m.errorStatusPredicate != nil {
+		return m.errorStatusPredicate(statusCode)
+	}
+	return statusCode >= m.errorStatusMin && statusCode <= m.errorStatusMax
 }
 
 // CollectDependencyTime collet the duration of dependency requests in seconds
@@ -102,41 +470,135 @@ func (m *Monitor) CollectDependencyTime(name, reqType, status, method, addr, isE
 }
 
 // Prometheus implements mux.MiddlewareFunc.
+// Requests aborted by the following handlers (e.g. an auth rejection) are recorded with the status they were aborted with,
+// and requests not matching any route are recorded with UnmatchedPath, or the label set by WithUnmatchedPathLabel, as their addr label.
 func (m *Monitor) Prometheus() gin.HandlerFunc {
+	return m.PrometheusWithLabels(nil)
+}
+
+// PrometheusWithLabels implements mux.MiddlewareFunc, adding static label values to the request metrics.
+// It is meant to be used on a gin.RouterGroup, and panics if a label was not declared with WithGroupLabels.
+func (m *Monitor) PrometheusWithLabels(labels gin.H) gin.HandlerFunc {
+	groupValues := m.groupLabelValues(labels)
+
 	return func(c *gin.Context) {
+		entered := time.Now()
+		if m.isExcluded(c) {
+			c.Next()
+			return
+		}
+
 		w := c.Writer
 		r := c.Request
 		respWriter := NewResponseWriter(w)
 
-		path := r.URL.Path
+		path := m.routeLabel(c)
 
-		c.Next()
+		var firstWrite *firstWriteRecorder
+		if m.timeToFirstByte != nil {
+			firstWrite = &firstWriteRecorder{ResponseWriter: c.Writer}
+			c.Writer = firstWrite
+		}
 
-		duration := time.Since(respWriter.started)
+		inFlight := m.inFlight.WithLabelValues(r.Method)
+		inFlight.Inc()
+		m.inFlightRequests.Add(1)
+		defer m.inFlightRequests.Add(-1)
+		defer inFlight.Dec()
 
-		statusCodeStr := respWriter.StatusCodeStr()
-		isErrorStr := strconv.FormatBool(m.IsStatusError(respWriter.statusCode))
+		defer func() {
+			recovered := recover()
+			duration := time.Since(entered)
+			addr := m.addrLabel(c, path)
+
+			statusCode := c.Writer.Status()
+			if recovered != nil {
+				m.panicsRecovered.WithLabelValues(addr, r.Method).Inc()
+				statusCode = http.StatusInternalServerError
+				if !m.repanic {
+					c.AbortWithStatus(statusCode)
+				}
+			}
 
-		errorMessage := r.Header.Get(m.errorMessageKey)
-		r.Header.Del(m.errorMessageKey)
+			errorMessage := r.Header.Get(m.errorMessageKey)
+			r.Header.Del(m.errorMessageKey)
 
-		m.collectTime(r.Proto, statusCodeStr, r.Method, path, isErrorStr, errorMessage, duration.Seconds())
-		m.collectSize(r.Proto, statusCodeStr, r.Method, path, isErrorStr, errorMessage, float64(respWriter.Count()))
+			labels := m.requestLabelValues(c, statusCode, addr, errorMessage, groupValues)
+
+			observeDuration := !c.GetBool(SkipDurationKey)
+			m.requestsTotal.WithLabelValues(labels...).Inc()
+			if observeDuration {
+				m.collectTime(c, addr, labels, duration.Seconds())
+				if handlerDuration, ok := c.Get(handlerDurationKey); ok {
+					m.handlerDuration.WithLabelValues(labels...).Observe(handlerDuration.(time.Duration).Seconds())
+				}
+				if m.slowRequests != nil && duration > m.slowRequestThreshold {
+					m.slowRequests.WithLabelValues(addr, r.Method).Inc()
+				}
+			}
+			if firstWrite != nil && !firstWrite.at().IsZero() {
+				m.timeToFirstByte.WithLabelValues(labels...).Observe(firstWrite.at().Sub(entered).Seconds())
+			}
+			m.collectSize(labels, float64(respWriter.Count()))
+			m.collectBodySizes(c, labels)
+			m.collectError(c, statusCode, addr)
+			m.collectOtel(c, labels, duration.Seconds(), observeDuration)
+
+			if recovered != nil && m.repanic {
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
 	}
 }
 
-// AddDependencyChecker creates a ticker that periodically executes the checker and collects the dependency state metrics
-func (m *Monitor) AddDependencyChecker(checker DependencyChecker, checkingPeriod time.Duration) {
-	ticker := time.NewTicker(checkingPeriod)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				status := checker.Check()
-				m.dependencyUP.WithLabelValues(checker.GetDependencyName()).Set(float64(status))
-			}
+// HandlerTimer times the handlers following it, which the middleware observes in the gin_handler_duration_seconds histogram
+// along with the total request duration. It is meant to be registered after the other middlewares, right before the route handlers,
+// so the histograms tell the time spent in the route handlers apart from the time spent in the middlewares.
+// Requests not going through it, or not recorded by the middleware, are not observed.
+func (m *Monitor) HandlerTimer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		defer func() {
+			c.Set(handlerDurationKey, time.Since(started))
+		}()
+		c.Next()
+	}
+}
+
+// inFlightPollInterval is how often WaitForInFlight checks the in-flight requests
+const inFlightPollInterval = 10 * time.Millisecond
+
+// WaitForInFlight blocks until no request is being processed by the middleware, or the context is done.
+// It is meant for draining the server on shutdown, and returns an error if requests were still in flight.
+func (m *Monitor) WaitForInFlight(ctx context.Context) error {
+	ticker := time.NewTicker(inFlightPollInterval)
+	defer ticker.Stop()
+	for {
+		if m.inFlightRequests.Load() == 0 {
+			return nil
 		}
-	}()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests still in flight: %w", m.inFlightRequests.Load(), ctx.Err())
+		}
+	}
+}
+
+// isExcluded reports whether the request must not be recorded, calling the skipper before matching the excluded paths
+func (m *Monitor) isExcluded(c *gin.Context) bool {
+	if m.skipper != nil && m.skipper(c) {
+		return true
+	}
+
+	path := c.FullPath()
+	if path == "" {
+		return m.excludeUnmatched
+	}
+	_, excluded := m.excludedPaths[path]
+	return excluded
 }
 
 func IsStatusError(statusCode int) bool {
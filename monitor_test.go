@@ -0,0 +1,933 @@
+package gin_monitor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestMonitor creates a monitor registered with a fresh registry, shut down when the test ends.
+func newTestMonitor(t *testing.T, opts ...Option) (*Monitor, *prometheus.Registry) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	monitor, err := New("v1.0.0", append([]Option{WithRegistry(registry)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = monitor.Shutdown(context.Background())
+	})
+	return monitor, registry
+}
+
+// findFamily gathers the registry and returns the metric family with the given name.
+func findFamily(t *testing.T, gatherer prometheus.Gatherer, name string) *dto.MetricFamily {
+	t.Helper()
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family
+		}
+	}
+	return nil
+}
+
+func TestNewRejectsEmptyVersion(t *testing.T) {
+	if _, err := New("  ", WithRegistry(prometheus.NewRegistry())); err == nil {
+		t.Fatal("expected an error for an empty application version")
+	}
+}
+
+func TestPrometheusInFlightRequests(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	release := make(chan struct{})
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/slow", func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	const requests = 3
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(server.URL + "/slow")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = resp.Body.Close()
+		}()
+	}
+
+	inFlight := func() float64 {
+		family := findFamily(t, registry, "gin_in_flight_requests")
+		if family == nil {
+			return 0
+		}
+		return family.GetMetric()[0].GetGauge().GetValue()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for inFlight() != requests && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := inFlight(); got != requests {
+		t.Fatalf("expected %d in-flight requests, got %v", requests, got)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if got := inFlight(); got != 0 {
+		t.Errorf("expected no in-flight requests, got %v", got)
+	}
+}
+
+// serve sends a request to the handler and returns the recorded response.
+func serve(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+// labelValues returns the values of the given label across every sample of the metric family.
+func labelValues(family *dto.MetricFamily, label string) []string {
+	var values []string
+	for _, metric := range family.GetMetric() {
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == label {
+				values = append(values, pair.GetValue())
+			}
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func TestPrometheusExcludedPaths(t *testing.T) {
+	tests := []struct {
+		name             string
+		excludeUnmatched bool
+		want             []string
+	}{
+		{name: "unmatched recorded", want: []string{"/users", UnmatchedPath}},
+		{name: "unmatched excluded", excludeUnmatched: true, want: []string{"/users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, WithExcludedPaths("/metrics", "/healthz"), WithExcludeUnmatched(tt.excludeUnmatched))
+
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			for _, path := range []string{"/metrics", "/healthz", "/users"} {
+				r.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+			}
+
+			for _, path := range []string{"/metrics", "/healthz", "/users", "/missing"} {
+				serve(r, http.MethodGet, path)
+			}
+
+			family := findFamily(t, registry, "request_seconds")
+			if family == nil {
+				t.Fatal("expected request_seconds to have samples")
+			}
+			if got := labelValues(family, "addr"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected addr labels %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPrometheusRouteTemplateLabel(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, id := range []string{"1", "2", "3"} {
+		serve(r, http.MethodGet, "/users/"+id)
+	}
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := labelValues(family, "addr"); !reflect.DeepEqual(got, []string{"/users/:id"}) {
+		t.Errorf("expected a single /users/:id series, got %v", got)
+	}
+	if got := family.GetMetric()[0].GetHistogram().GetSampleCount(); got != 3 {
+		t.Errorf("expected 3 observations, got %d", got)
+	}
+}
+
+func TestNewWithRegistry(t *testing.T) {
+	first, firstRegistry := newTestMonitor(t)
+	second, secondRegistry := newTestMonitor(t)
+
+	if first.Registry() != firstRegistry || second.Registry() != secondRegistry {
+		t.Fatal("expected each monitor to expose its own registry")
+	}
+
+	if _, err := New("v1.0.0", WithRegistry(firstRegistry)); err == nil {
+		t.Fatal("expected an error registering a second monitor with the same registry")
+	}
+
+	if findFamily(t, firstRegistry, "application_info") == nil || findFamily(t, secondRegistry, "application_info") == nil {
+		t.Error("expected application_info to be registered with both registries")
+	}
+}
+
+func TestPrometheusBodySizes(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.POST("/echo", func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "text/plain", body)
+	})
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("a", 100))))
+
+	for _, name := range []string{"gin_request_size_bytes", "gin_response_size_bytes"} {
+		family := findFamily(t, registry, name)
+		if family == nil {
+			t.Fatalf("expected %s to have samples", name)
+		}
+		histogram := family.GetMetric()[0].GetHistogram()
+		if histogram.GetSampleSum() != 100 {
+			t.Errorf("%s: expected sum 100, got %v", name, histogram.GetSampleSum())
+		}
+		for _, bucket := range histogram.GetBucket() {
+			want := uint64(0)
+			if bucket.GetUpperBound() >= 100 {
+				want = 1
+			}
+			if bucket.GetCumulativeCount() != want {
+				t.Errorf("%s: expected %d observations up to %v, got %d", name, want, bucket.GetUpperBound(), bucket.GetCumulativeCount())
+			}
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.ContentLength = -1
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	family := findFamily(t, registry, "gin_request_size_bytes")
+	if got := labelValues(family, "addr"); !reflect.DeepEqual(got, []string{"/echo"}) {
+		t.Errorf("expected unknown request lengths to be skipped, got series for %v", got)
+	}
+}
+
+func TestPrometheusPanicRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		repanic bool
+	}{
+		{name: "repanic", repanic: true},
+		{name: "recover", repanic: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, WithRepanic(tt.repanic))
+
+			r := gin.New()
+			if tt.repanic {
+				r.Use(gin.RecoveryWithWriter(ioutil.Discard))
+			}
+			r.Use(monitor.Prometheus())
+			r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+			if w := serve(r, http.MethodGet, "/panic"); w.Code != http.StatusInternalServerError {
+				t.Errorf("expected status 500, got %d", w.Code)
+			}
+
+			panics := findFamily(t, registry, "gin_panics_recovered_total")
+			if panics == nil || panics.GetMetric()[0].GetCounter().GetValue() != 1 {
+				t.Fatal("expected one recovered panic to be counted")
+			}
+			if got := labelValues(panics, "addr"); !reflect.DeepEqual(got, []string{"/panic"}) {
+				t.Errorf("expected the panic to be labeled with /panic, got %v", got)
+			}
+
+			requests := findFamily(t, registry, "request_seconds")
+			if requests == nil || requests.GetMetric()[0].GetHistogram().GetSampleCount() != 1 {
+				t.Fatal("expected the panicking request to be observed")
+			}
+			if got := labelValues(requests, "status"); !reflect.DeepEqual(got, []string{"500"}) {
+				t.Errorf("expected the panicking request to be recorded as 500, got %v", got)
+			}
+		})
+	}
+}
+
+func TestNewBuildInfo(t *testing.T) {
+	_, registry := newTestMonitor(t, WithCommit("abc123"))
+
+	family := findFamily(t, registry, "gin_build_info")
+	if family == nil {
+		t.Fatal("expected gin_build_info to be gathered")
+	}
+	if got := family.GetMetric()[0].GetGauge().GetValue(); got != 1 {
+		t.Errorf("expected gin_build_info to be 1, got %v", got)
+	}
+	for label, want := range map[string]string{"version": "v1.0.0", "goversion": runtime.Version(), "commit": "abc123"} {
+		if got := labelValues(family, label); !reflect.DeepEqual(got, []string{want}) {
+			t.Errorf("expected %s label %q, got %v", label, want, got)
+		}
+	}
+}
+
+func TestPrometheusSkipper(t *testing.T) {
+	skipper := func(c *gin.Context) bool {
+		return c.GetHeader("X-Internal-Health") != ""
+	}
+	monitor, registry := newTestMonitor(t, WithSkipper(skipper), WithExcludedPaths("/metrics"))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	skipped := httptest.NewRequest(http.MethodGet, "/users", nil)
+	skipped.Header.Set("X-Internal-Health", "true")
+	r.ServeHTTP(httptest.NewRecorder(), skipped)
+	serve(r, http.MethodGet, "/metrics")
+	serve(r, http.MethodGet, "/users")
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := family.GetMetric()[0].GetHistogram().GetSampleCount(); len(family.GetMetric()) != 1 || got != 1 {
+		t.Errorf("expected only the request without the header to be recorded, got %d series and %d observations", len(family.GetMetric()), got)
+	}
+}
+
+func TestPrometheusSlowRequests(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithSlowRequestThreshold(20*time.Millisecond))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(40 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve(r, http.MethodGet, "/slow")
+	serve(r, http.MethodGet, "/fast")
+
+	family := findFamily(t, registry, "gin_slow_requests_total")
+	if family == nil {
+		t.Fatal("expected gin_slow_requests_total to have samples")
+	}
+	if got := labelValues(family, "addr"); !reflect.DeepEqual(got, []string{"/slow"}) {
+		t.Errorf("expected only the slow request to be counted, got %v", got)
+	}
+	if got := family.GetMetric()[0].GetCounter().GetValue(); got != 1 {
+		t.Errorf("expected one slow request, got %v", got)
+	}
+}
+
+func TestPrometheusSlowRequestsUnset(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	serve(r, http.MethodGet, "/")
+
+	if findFamily(t, registry, "gin_slow_requests_total") != nil {
+		t.Error("expected gin_slow_requests_total not to be registered without a threshold")
+	}
+}
+
+func TestPrometheusExemplars(t *testing.T) {
+	extractor := func(c *gin.Context) (prometheus.Labels, bool) {
+		traceID := c.GetHeader("X-Trace-Id")
+		return prometheus.Labels{"trace_id": traceID}, traceID != ""
+	}
+	monitor, registry := newTestMonitor(t, WithExemplarExtractor(extractor))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/traced", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/untraced", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	traced := httptest.NewRequest(http.MethodGet, "/traced", nil)
+	traced.Header.Set("X-Trace-Id", "4bf92f3577b34da6")
+	r.ServeHTTP(httptest.NewRecorder(), traced)
+	serve(r, http.MethodGet, "/untraced")
+
+	exemplars := map[string][]string{}
+	for _, metric := range findFamily(t, registry, "request_seconds").GetMetric() {
+		var addr string
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == "addr" {
+				addr = pair.GetValue()
+			}
+		}
+		for _, bucket := range metric.GetHistogram().GetBucket() {
+			for _, pair := range bucket.GetExemplar().GetLabel() {
+				exemplars[addr] = append(exemplars[addr], pair.GetName()+"="+pair.GetValue())
+			}
+		}
+	}
+
+	want := map[string][]string{"/traced": {"trace_id=4bf92f3577b34da6"}}
+	if !reflect.DeepEqual(exemplars, want) {
+		t.Errorf("expected exemplars %v, got %v", want, exemplars)
+	}
+}
+
+func TestPrometheusInvalidExemplars(t *testing.T) {
+	extractor := func(c *gin.Context) (prometheus.Labels, bool) {
+		traceID := c.GetHeader("X-Trace-Id")
+		return prometheus.Labels{"trace_id": traceID}, traceID != ""
+	}
+	monitor, registry := newTestMonitor(t, WithExemplarExtractor(extractor))
+
+	r := gin.New()
+	r.Use(gin.Recovery(), monitor.Prometheus())
+	r.GET("/traced", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, traceID := range []string{strings.Repeat("a", 200), "4bf92f35\xff"} {
+		req := httptest.NewRequest(http.MethodGet, "/traced", nil)
+		req.Header.Set("X-Trace-Id", traceID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected an invalid trace ID not to fail the request, got status %d", w.Code)
+		}
+	}
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	metric := family.GetMetric()[0]
+	if got := metric.GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("expected the requests to be observed without exemplars, got %d observations", got)
+	}
+	for _, bucket := range metric.GetHistogram().GetBucket() {
+		if bucket.GetExemplar() != nil {
+			t.Errorf("expected no exemplar, got %v", bucket.GetExemplar())
+		}
+	}
+}
+
+func TestPrometheusAbortedRequests(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus(), func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+	r.GET("/secure", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve(r, http.MethodGet, "/secure")
+	serve(r, http.MethodGet, "/unknown")
+
+	family := findFamily(t, registry, "request_seconds")
+	if family == nil {
+		t.Fatal("expected request_seconds to have samples")
+	}
+	if got := labelValues(family, "addr"); !reflect.DeepEqual(got, []string{"/secure", UnmatchedPath}) {
+		t.Errorf("expected the aborted requests to be recorded per route, got %v", got)
+	}
+	if got := labelValues(family, "status"); !reflect.DeepEqual(got, []string{"401", "401"}) {
+		t.Errorf("expected the aborted requests to be recorded as 401, got %v", got)
+	}
+	for _, metric := range family.GetMetric() {
+		if got := metric.GetHistogram().GetSampleCount(); got != 1 {
+			t.Errorf("expected one observation per series, got %d", got)
+		}
+	}
+}
+
+func TestPrometheusLatencySummary(t *testing.T) {
+	objectives := map[float64]float64{0.5: 0.05, 0.99: 0.001}
+	for _, tc := range []struct {
+		name      string
+		opts      []Option
+		summary   bool
+		histogram bool
+	}{
+		{name: "unset", histogram: true},
+		{name: "alongside the histogram", opts: []Option{WithLatencySummary(objectives)}, summary: true, histogram: true},
+		{name: "in place of the histogram", opts: []Option{WithLatencySummaryOnly(objectives)}, summary: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, tc.opts...)
+
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+			for i := 0; i < 10; i++ {
+				serve(r, http.MethodGet, "/ping")
+			}
+
+			if got := findFamily(t, registry, "request_seconds") != nil; got != tc.histogram {
+				t.Errorf("expected request_seconds to be registered: %v, got %v", tc.histogram, got)
+			}
+
+			family := findFamily(t, registry, "gin_request_duration_summary_seconds")
+			if got := family != nil; got != tc.summary {
+				t.Fatalf("expected gin_request_duration_summary_seconds to be registered: %v, got %v", tc.summary, got)
+			}
+			if family == nil {
+				return
+			}
+
+			summary := family.GetMetric()[0].GetSummary()
+			if got := summary.GetSampleCount(); got != 10 {
+				t.Errorf("expected 10 observations, got %d", got)
+			}
+			if got := len(summary.GetQuantile()); got != len(objectives) {
+				t.Fatalf("expected %d quantiles, got %d", len(objectives), got)
+			}
+			for _, quantile := range summary.GetQuantile() {
+				if _, ok := objectives[quantile.GetQuantile()]; !ok || math.IsNaN(quantile.GetValue()) {
+					t.Errorf("expected quantile %v to be populated, got %v", quantile.GetQuantile(), quantile.GetValue())
+				}
+			}
+		})
+	}
+}
+
+// errorSeries returns the label pairs of every gin_request_errors_total series along with its count
+func errorSeries(t *testing.T, gatherer prometheus.Gatherer) map[string]float64 {
+	t.Helper()
+	series := map[string]float64{}
+	family := findFamily(t, gatherer, "gin_request_errors_total")
+	for _, metric := range family.GetMetric() {
+		var pairs []string
+		for _, pair := range metric.GetLabel() {
+			pairs = append(pairs, pair.GetName()+"="+pair.GetValue())
+		}
+		series[strings.Join(pairs, ",")] = metric.GetCounter().GetValue()
+	}
+	return series
+}
+
+func TestPrometheusRequestErrors(t *testing.T) {
+	longMessage := strings.Repeat("x", DefaultErrorLabelMaxLength+10)
+	tests := []struct {
+		name string
+		opts []Option
+		want map[string]float64
+	}{
+		{
+			name: "defaults",
+			want: map[string]float64{
+				"addr=/fail,error=connection refused by upstream,method=GET,status=502":                   1,
+				"addr=/long,error=" + longMessage[:DefaultErrorLabelMaxLength] + ",method=GET,status=500": 1,
+				"addr=/silent,error=,method=GET,status=503":                                               1,
+			},
+		},
+		{
+			name: "error label disabled",
+			opts: []Option{WithErrorLabel(false)},
+			want: map[string]float64{
+				"addr=/fail,method=GET,status=502":   1,
+				"addr=/long,method=GET,status=500":   1,
+				"addr=/silent,method=GET,status=503": 1,
+			},
+		},
+		{
+			name: "custom range and length",
+			opts: []Option{WithErrorStatusRange(400, 502), WithErrorLabelMaxLength(10)},
+			want: map[string]float64{
+				"addr=/fail,error=connection,method=GET,status=502": 1,
+				"addr=/long,error=xxxxxxxxxx,method=GET,status=500": 1,
+				"addr=/missing,error=,method=GET,status=404":        1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, tt.opts...)
+
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			r.GET("/fail", func(c *gin.Context) {
+				c.Set(DefaultErrorMessageKey, errors.New("connection  refused\nby upstream"))
+				c.Status(http.StatusBadGateway)
+			})
+			r.GET("/long", func(c *gin.Context) {
+				c.Set(DefaultErrorMessageKey, longMessage)
+				c.Status(http.StatusInternalServerError)
+			})
+			r.GET("/silent", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+			r.GET("/missing", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+			r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for _, path := range []string{"/fail", "/long", "/silent", "/missing", "/ok"} {
+				serve(r, http.MethodGet, path)
+			}
+
+			if got := errorSeries(t, registry); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected series %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPrometheusSkipDuration(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithSlowRequestThreshold(time.Nanosecond))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/stream", func(c *gin.Context) {
+		c.Set(SkipDurationKey, true)
+		c.Status(http.StatusOK)
+	})
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve(r, http.MethodGet, "/stream")
+	serve(r, http.MethodGet, "/ping")
+
+	if got := labelValues(findFamily(t, registry, "gin_requests_total"), "addr"); !reflect.DeepEqual(got, []string{"/ping", "/stream"}) {
+		t.Errorf("expected both requests to be counted, got %v", got)
+	}
+	if got := labelValues(findFamily(t, registry, "request_seconds"), "addr"); !reflect.DeepEqual(got, []string{"/ping"}) {
+		t.Errorf("expected only the duration of /ping to be observed, got %v", got)
+	}
+	if got := labelValues(findFamily(t, registry, "gin_slow_requests_total"), "addr"); !reflect.DeepEqual(got, []string{"/ping"}) {
+		t.Errorf("expected only /ping to be counted as slow, got %v", got)
+	}
+}
+
+func TestPrometheusRequestErrorsSources(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/keys", func(c *gin.Context) {
+		c.Set(DefaultErrorMessageKey, "from keys")
+		c.Error(errors.New("from errors"))
+		c.Status(http.StatusInternalServerError)
+	})
+	r.GET("/errors", func(c *gin.Context) {
+		c.Error(errors.New("first error"))
+		c.Error(errors.New("last error"))
+		c.Status(http.StatusInternalServerError)
+	})
+	r.GET("/neither", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	for _, path := range []string{"/keys", "/errors", "/neither"} {
+		serve(r, http.MethodGet, path)
+	}
+
+	want := map[string]float64{
+		"addr=/keys,error=from keys,method=GET,status=500":    1,
+		"addr=/errors,error=last error,method=GET,status=500": 1,
+		"addr=/neither,error=,method=GET,status=500":          1,
+	}
+	if got := errorSeries(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected series %v, got %v", want, got)
+	}
+}
+
+func TestPrometheusRequestErrorsInvalidUTF8(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithErrorStatusRange(400, 599))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/keys", func(c *gin.Context) {
+		c.Set(DefaultErrorMessageKey, "bad input \xff")
+		c.Status(http.StatusBadRequest)
+	})
+	r.GET("/errors", func(c *gin.Context) {
+		c.Error(errors.New("bad input \xff\xfe"))
+		c.Status(http.StatusBadRequest)
+	})
+
+	for _, path := range []string{"/keys", "/errors"} {
+		if w := serve(r, http.MethodGet, path); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", path, w.Code)
+		}
+	}
+
+	want := map[string]float64{
+		"addr=/keys,error=bad input \uFFFD,method=GET,status=400":   1,
+		"addr=/errors,error=bad input \uFFFD,method=GET,status=400": 1,
+	}
+	if got := errorSeries(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected series %v, got %v", want, got)
+	}
+	if got := labelValues(findFamily(t, registry, "request_seconds"), "addr"); !reflect.DeepEqual(got, []string{"/errors", "/keys"}) {
+		t.Errorf("expected the request durations to be recorded, got %v", got)
+	}
+}
+
+func TestWithErrorStatusPredicate(t *testing.T) {
+	expected := map[int]bool{http.StatusTooManyRequests: true, 499: true}
+	monitor, registry := newTestMonitor(t, WithErrorLabel(false), WithErrorStatusPredicate(func(statusCode int) bool {
+		return statusCode >= 400 && !expected[statusCode]
+	}))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/status/:code", func(c *gin.Context) {
+		code, _ := strconv.Atoi(c.Param("code"))
+		c.Status(code)
+	})
+
+	for _, code := range []string{"200", "402", "429", "499", "503"} {
+		serve(r, http.MethodGet, "/status/"+code)
+	}
+
+	want := map[string]float64{
+		"addr=/status/:code,method=GET,status=402": 1,
+		"addr=/status/:code,method=GET,status=503": 1,
+	}
+	if got := errorSeries(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected series %v, got %v", want, got)
+	}
+
+	isError := map[string]string{}
+	for _, metric := range findFamily(t, registry, "request_seconds").GetMetric() {
+		labels := map[string]string{}
+		for _, pair := range metric.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		isError[labels["status"]] = labels["isError"]
+	}
+	wantIsError := map[string]string{"200": "false", "402": "true", "429": "false", "499": "false", "503": "true"}
+	if !reflect.DeepEqual(isError, wantIsError) {
+		t.Errorf("expected isError labels %v, got %v", wantIsError, isError)
+	}
+}
+
+func TestWaitForInFlight(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(r, http.MethodGet, "/slow")
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := monitor.WaitForInFlight(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded while the request is in flight, got %v", err)
+	}
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := monitor.WaitForInFlight(ctx); err != nil {
+		t.Errorf("expected the request to finish before the deadline, got %v", err)
+	}
+	<-done
+}
+
+func TestRequestAccessors(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithStatusClassLabel(), WithGroupLabels("team"))
+
+	want := []string{"type", "status", "method", "addr", "isError", "errorMessage", "status_class", "team"}
+	if got := monitor.RequestLabelNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected label names %v, got %v", want, got)
+	}
+
+	values := []string{"HTTP/1.1", "200", "GET", "/batch", "false", "", "2xx", "payments"}
+	monitor.RequestsCounter().WithLabelValues(values...).Inc()
+	monitor.RequestDuration().WithLabelValues(values...).Observe(0.5)
+
+	labels := prometheus.Labels{"addr": "/batch", "team": "payments"}
+	if got, err := GatherValue(registry, "gin_requests_total", labels); err != nil || got != 1 {
+		t.Errorf("expected the request recorded via the accessor to be gathered, got %v (%v)", got, err)
+	}
+	if got, err := GatherValue(registry, "request_seconds", labels); err != nil || got != 1 {
+		t.Errorf("expected the duration observed via the accessor to be gathered, got %v (%v)", got, err)
+	}
+}
+
+func TestWithTimeToFirstByte(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithTimeToFirstByte(), WithBuckets([]float64{0.02, 0.05, 1}))
+
+	const firstByteDelay, streamDelay = 30 * time.Millisecond, 60 * time.Millisecond
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/stream", func(c *gin.Context) {
+		time.Sleep(firstByteDelay)
+		c.Writer.WriteString("first chunk")
+		c.Writer.Flush()
+		time.Sleep(streamDelay)
+		c.Writer.WriteString("last chunk")
+	})
+	r.GET("/empty", func(c *gin.Context) {})
+
+	serve(r, http.MethodGet, "/stream")
+	serve(r, http.MethodGet, "/empty")
+
+	ttfb := findFamily(t, registry, "gin_request_ttfb_seconds")
+	if ttfb == nil {
+		t.Fatal("expected gin_request_ttfb_seconds to have samples")
+	}
+	if got := labelValues(ttfb, "addr"); !reflect.DeepEqual(got, []string{"/stream"}) {
+		t.Errorf("expected only the written response to be observed, got %v", got)
+	}
+	first := ttfb.GetMetric()[0].GetHistogram().GetSampleSum()
+	if first < firstByteDelay.Seconds() || first >= (firstByteDelay+streamDelay).Seconds() {
+		t.Errorf("expected the time to first byte to last about %v, got %vs", firstByteDelay, first)
+	}
+
+	for _, metric := range findFamily(t, registry, "request_seconds").GetMetric() {
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == "addr" && pair.GetValue() == "/stream" {
+				if total := metric.GetHistogram().GetSampleSum(); total < (firstByteDelay + streamDelay).Seconds() {
+					t.Errorf("expected the total duration to include the stream, got %vs", total)
+				}
+			}
+		}
+	}
+}
+
+func TestWithTimeToFirstByteStatusFirst(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithTimeToFirstByte())
+
+	const firstByteDelay = 50 * time.Millisecond
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/stream", func(c *gin.Context) {
+		// gin only stores the status, nothing is sent before the first write
+		c.Status(http.StatusOK)
+		time.Sleep(firstByteDelay)
+		c.Writer.WriteString("x")
+	})
+	r.GET("/flush", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		time.Sleep(firstByteDelay)
+		c.Writer.Flush()
+	})
+	serve(r, http.MethodGet, "/stream")
+	serve(r, http.MethodGet, "/flush")
+
+	ttfb := findFamily(t, registry, "gin_request_ttfb_seconds")
+	if ttfb == nil {
+		t.Fatal("expected gin_request_ttfb_seconds to have samples")
+	}
+	for _, metric := range ttfb.GetMetric() {
+		if got := metric.GetHistogram().GetSampleSum(); got < firstByteDelay.Seconds() {
+			t.Errorf("expected the time to first byte to include the delay before the first write, got %vs", got)
+		}
+	}
+	if got := labelValues(ttfb, "addr"); !reflect.DeepEqual(got, []string{"/flush", "/stream"}) {
+		t.Errorf("expected both responses to be observed, got %v", got)
+	}
+}
+
+func TestWithoutTimeToFirstByte(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) {
+		if _, wrapped := c.Writer.(*firstWriteRecorder); wrapped {
+			t.Error("expected the response writer not to be wrapped")
+		}
+		c.Status(http.StatusOK)
+	})
+	serve(r, http.MethodGet, "/ping")
+
+	if findFamily(t, registry, "gin_request_ttfb_seconds") != nil {
+		t.Error("expected gin_request_ttfb_seconds not to be registered")
+	}
+}
+
+func TestHandlerTimer(t *testing.T) {
+	const middlewareDelay, handlerDelay = 40 * time.Millisecond, 20 * time.Millisecond
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.Use(func(c *gin.Context) {
+		time.Sleep(middlewareDelay)
+		c.Next()
+	})
+	r.Use(monitor.HandlerTimer())
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(handlerDelay)
+		c.Status(http.StatusOK)
+	})
+	serve(r, http.MethodGet, "/slow")
+
+	handler := findFamily(t, registry, "gin_handler_duration_seconds")
+	total := findFamily(t, registry, "request_seconds")
+	if handler == nil || total == nil {
+		t.Fatal("expected gin_handler_duration_seconds and request_seconds to have samples")
+	}
+	handlerSeconds := handler.GetMetric()[0].GetHistogram().GetSampleSum()
+	totalSeconds := total.GetMetric()[0].GetHistogram().GetSampleSum()
+
+	if handlerSeconds < handlerDelay.Seconds() || handlerSeconds >= (handlerDelay+middlewareDelay).Seconds() {
+		t.Errorf("expected the handler duration to last about %v, got %vs", handlerDelay, handlerSeconds)
+	}
+	if diff := totalSeconds - handlerSeconds; diff < middlewareDelay.Seconds() || diff >= (middlewareDelay+handlerDelay).Seconds() {
+		t.Errorf("expected the total duration to exceed the handler duration by about %v, got %vs", middlewareDelay, diff)
+	}
+}
+
+func TestWithoutHandlerTimer(t *testing.T) {
+	monitor, registry := newTestMonitor(t)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	serve(r, http.MethodGet, "/ping")
+
+	if findFamily(t, registry, "gin_handler_duration_seconds") != nil {
+		t.Error("expected gin_handler_duration_seconds not to have samples")
+	}
+}
@@ -0,0 +1,418 @@
+package gin_monitor
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Option configures a Monitor created by New.
+type Option func(*config)
+
+type config struct {
+	errorMessageKey        string
+	buckets                []float64
+	sizeBuckets            []float64
+	dependencyCheckBuckets []float64
+	namespace              string
+	subsystem              string
+	constLabels            prometheus.Labels
+	excludedPaths          map[string]struct{}
+	excludeUnmatched       bool
+	skipper                func(*gin.Context) bool
+	statusClassLabel       bool
+	statusClassOnly        bool
+	repanic                bool
+	commit                 string
+	groupLabels            []string
+	checkJitter            float64
+	slowRequestThreshold   time.Duration
+	exemplarExtractor      func(*gin.Context) (prometheus.Labels, bool)
+	labelFunc              func(*gin.Context) string
+	nativeHistogramFactor  float64
+	latencyObjectives      map[float64]float64
+	latencySummaryOnly     bool
+	errorStatusMin         int
+	errorStatusMax         int
+	errorStatusPredicate   func(statusCode int) bool
+	errorLabel             bool
+	errorLabelMaxLength    int
+	headerLabels           []headerLabel
+	meterProvider          metric.MeterProvider
+	pathNormalization      bool
+	catchAllCollapse       bool
+	pathRules              []PathRule
+	tlsLabel               bool
+	unmatchedPath          string
+	userAgentClassifier    func(userAgent string) string
+	statusChangeHook       func(name string, from, to DependencyStatus)
+	timeToFirstByte        bool
+	registerer             prometheus.Registerer
+}
+
+func newConfig(opts ...Option) config {
+	cfg := config{
+		errorMessageKey:        DefaultErrorMessageKey,
+		buckets:                DefaultBuckets,
+		sizeBuckets:            DefaultSizeBuckets,
+		dependencyCheckBuckets: DefaultDependencyCheckBuckets,
+		registerer:             prometheus.DefaultRegisterer,
+		repanic:                true,
+		errorStatusMin:         http.StatusInternalServerError,
+		errorStatusMax:         599,
+		errorLabel:             true,
+		errorLabelMaxLength:    DefaultErrorLabelMaxLength,
+		unmatchedPath:          UnmatchedPath,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithErrorMessageKey sets the request header key used to read the error message label,
+// and the context key used to read the error label of the gin_request_errors_total metric.
+// An empty key keeps DefaultErrorMessageKey.
+func WithErrorMessageKey(key string) Option {
+	return func(cfg *config) {
+		if strings.TrimSpace(key) != "" {
+			cfg.errorMessageKey = key
+		}
+	}
+}
+
+// WithBuckets sets the histogram buckets for request and dependency durations.
+// A nil slice keeps DefaultBuckets.
+func WithBuckets(buckets []float64) Option {
+	return func(cfg *config) {
+		if buckets != nil {
+			cfg.buckets = buckets
+		}
+	}
+}
+
+// WithSizeBuckets sets the histogram buckets for request and response body sizes.
+// A nil slice keeps DefaultSizeBuckets.
+func WithSizeBuckets(buckets []float64) Option {
+	return func(cfg *config) {
+		if buckets != nil {
+			cfg.sizeBuckets = buckets
+		}
+	}
+}
+
+// WithDependencyCheckBuckets sets the histogram buckets for dependency check durations.
+// A nil slice keeps DefaultDependencyCheckBuckets.
+func WithDependencyCheckBuckets(buckets []float64) Option {
+	return func(cfg *config) {
+		if buckets != nil {
+			cfg.dependencyCheckBuckets = buckets
+		}
+	}
+}
+
+// WithNamespace sets the namespace prefixed to every metric name,
+// replacing the gin namespace of the gin_* metrics, such as gin_requests_total.
+func WithNamespace(namespace string) Option {
+	return func(cfg *config) {
+		cfg.namespace = namespace
+	}
+}
+
+// ginNamespace returns the namespace of the gin_* metrics, which is replaced by the one set by WithNamespace
+func (cfg config) ginNamespace() string {
+	if cfg.namespace != "" {
+		return cfg.namespace
+	}
+	return "gin"
+}
+
+// WithSubsystem sets the subsystem prefixed to every metric name, after the namespace.
+func WithSubsystem(subsystem string) Option {
+	return func(cfg *config) {
+		cfg.subsystem = subsystem
+	}
+}
+
+// WithConstLabels sets labels with constant values added to every metric.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(cfg *config) {
+		cfg.constLabels = labels
+	}
+}
+
+// WithExcludedPaths disables metrics collection for the given route templates, as returned by gin.Context.FullPath.
+func WithExcludedPaths(paths ...string) Option {
+	return func(cfg *config) {
+		if cfg.excludedPaths == nil {
+			cfg.excludedPaths = make(map[string]struct{}, len(paths))
+		}
+		for _, path := range paths {
+			cfg.excludedPaths[path] = struct{}{}
+		}
+	}
+}
+
+// WithExcludeUnmatched disables metrics collection for requests that do not match any route.
+func WithExcludeUnmatched(exclude bool) Option {
+	return func(cfg *config) {
+		cfg.excludeUnmatched = exclude
+	}
+}
+
+// WithRegistry sets the registerer the metrics are registered with, defaults to prometheus.DefaultRegisterer.
+func WithRegistry(registerer prometheus.Registerer) Option {
+	return func(cfg *config) {
+		if registerer != nil {
+			cfg.registerer = registerer
+		}
+	}
+}
+
+// WithSkipper disables metrics collection for the requests the skipper returns true for.
+// The skipper is called before the paths excluded by WithExcludedPaths are matched.
+func WithSkipper(skipper func(*gin.Context) bool) Option {
+	return func(cfg *config) {
+		cfg.skipper = skipper
+	}
+}
+
+// WithStatusClassLabel adds the status_class label (e.g. 2xx, 5xx) to the request metrics.
+func WithStatusClassLabel() Option {
+	return func(cfg *config) {
+		cfg.statusClassLabel = true
+	}
+}
+
+// WithStatusClassOnly adds the status_class label to the request metrics in place of the status label.
+func WithStatusClassOnly() Option {
+	return func(cfg *config) {
+		cfg.statusClassLabel = true
+		cfg.statusClassOnly = true
+	}
+}
+
+// WithRepanic sets whether panics recovered by the middleware are raised again after being recorded, defaults to true.
+// When disabled, the middleware responds with 500 Internal Server Error instead.
+func WithRepanic(repanic bool) Option {
+	return func(cfg *config) {
+		cfg.repanic = repanic
+	}
+}
+
+// WithCommit sets the commit label of the gin_build_info metric.
+func WithCommit(commit string) Option {
+	return func(cfg *config) {
+		cfg.commit = commit
+	}
+}
+
+// WithGroupLabels declares the labels whose values are set by PrometheusWithLabels.
+// Routes served by Prometheus record them with empty values.
+func WithGroupLabels(names ...string) Option {
+	return func(cfg *config) {
+		cfg.groupLabels = append(cfg.groupLabels, names...)
+	}
+}
+
+// WithCheckJitter randomizes every interval between dependency checks by up to ±fraction of the checking period,
+// so checkers sharing the same period do not fire simultaneously. Defaults to no jitter.
+func WithCheckJitter(fraction float64) Option {
+	return func(cfg *config) {
+		if fraction < 0 {
+			fraction = 0
+		}
+		if fraction > 1 {
+			fraction = 1
+		}
+		cfg.checkJitter = fraction
+	}
+}
+
+// WithSlowRequestThreshold counts the requests lasting longer than the threshold in the gin_slow_requests_total metric,
+// which is only registered when this option is set.
+func WithSlowRequestThreshold(threshold time.Duration) Option {
+	return func(cfg *config) {
+		cfg.slowRequestThreshold = threshold
+	}
+}
+
+// WithExemplarExtractor attaches the labels returned by the extractor (e.g. a trace ID) as an exemplar
+// to the request duration observations. Requests it returns false for are observed without an exemplar.
+// Exemplars are only exposed by metrics endpoints serving the OpenMetrics format.
+func WithExemplarExtractor(extractor func(*gin.Context) (prometheus.Labels, bool)) Option {
+	return func(cfg *config) {
+		cfg.exemplarExtractor = extractor
+	}
+}
+
+// WithLabelFunc sets the function supplying the addr label value of the request metrics in place of the route template.
+// It is called once the request was handled, so context keys set by any handler are available.
+// Empty values fall back to the route template, and callers must keep the returned values low-cardinality.
+func WithLabelFunc(labelFunc func(*gin.Context) string) Option {
+	return func(cfg *config) {
+		cfg.labelFunc = labelFunc
+	}
+}
+
+// WithNativeHistograms exposes the request duration histogram as a native histogram along with the classic buckets,
+// growing each bucket by up to the factor (e.g. 1.1). A factor of zero keeps the classic buckets only.
+// Native histograms are only scraped by Prometheus servers with the native-histograms feature enabled.
+func WithNativeHistograms(factor float64) Option {
+	return func(cfg *config) {
+		cfg.nativeHistogramFactor = factor
+	}
+}
+
+// WithLatencySummary records the request durations in the gin_request_duration_summary_seconds summary as well,
+// with the given quantile objectives mapped to their absolute error. A nil map uses DefaultLatencyObjectives.
+func WithLatencySummary(objectives map[float64]float64) Option {
+	return func(cfg *config) {
+		if objectives == nil {
+			objectives = DefaultLatencyObjectives
+		}
+		cfg.latencyObjectives = objectives
+	}
+}
+
+// WithLatencySummaryOnly records the request durations in the gin_request_duration_summary_seconds summary
+// in place of the request_seconds histogram, which is then not registered.
+func WithLatencySummaryOnly(objectives map[float64]float64) Option {
+	return func(cfg *config) {
+		WithLatencySummary(objectives)(cfg)
+		cfg.latencySummaryOnly = true
+	}
+}
+
+// WithErrorStatusRange sets the inclusive range of status codes counted by the gin_request_errors_total metric,
+// defaults to 500 through 599.
+func WithErrorStatusRange(min, max int) Option {
+	return func(cfg *config) {
+		cfg.errorStatusMin = min
+		cfg.errorStatusMax = max
+	}
+}
+
+// WithErrorStatusPredicate sets which status codes are errors, in place of the range set by WithErrorStatusRange
+// for the gin_request_errors_total metric and of Monitor.IsStatusError for the isError label.
+// It does not affect the status label.
+func WithErrorStatusPredicate(predicate func(statusCode int) bool) Option {
+	return func(cfg *config) {
+		cfg.errorStatusPredicate = predicate
+	}
+}
+
+// WithErrorLabel sets whether the gin_request_errors_total metric has the error label, defaults to true.
+func WithErrorLabel(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.errorLabel = enabled
+	}
+}
+
+// WithErrorLabelMaxLength sets how many characters of the error message the error label keeps,
+// defaults to DefaultErrorLabelMaxLength. A non-positive length keeps the default.
+func WithErrorLabelMaxLength(length int) Option {
+	return func(cfg *config) {
+		if length > 0 {
+			cfg.errorLabelMaxLength = length
+		}
+	}
+}
+
+// WithHeaderLabels adds a label to the request metrics for each request header, mapping the header names to the label names.
+// Requests without the header record the label with an empty value.
+// Every distinct header value creates new series, so only low-cardinality headers (e.g. a tenant ID) should be used.
+func WithHeaderLabels(labels map[string]string) Option {
+	return func(cfg *config) {
+		for header, name := range labels {
+			cfg.headerLabels = append(cfg.headerLabels, headerLabel{header: header, name: name})
+		}
+		// map iteration order is random, while the label names need a stable order
+		sort.Slice(cfg.headerLabels, func(i, j int) bool {
+			return cfg.headerLabels[i].name < cfg.headerLabels[j].name
+		})
+	}
+}
+
+// WithMeterProvider mirrors the request count and duration into OpenTelemetry instruments created from the meter provider,
+// recording the request labels as attributes. The Prometheus metrics are collected either way.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(cfg *config) {
+		cfg.meterProvider = provider
+	}
+}
+
+// WithPathNormalization lowercases and strips the trailing slashes of the addr label value of the request metrics,
+// so variants of the same path are recorded in one series. It does not affect routing.
+func WithPathNormalization() Option {
+	return func(cfg *config) {
+		cfg.pathNormalization = true
+	}
+}
+
+// WithCatchAllCollapse replaces the catch-all segment of the addr label value of the request metrics,
+// such as *filepath in /files/*filepath, and everything after it with *, so every value captured by it is recorded in one series.
+// It operates on the label value and does not affect routing.
+func WithCatchAllCollapse() Option {
+	return func(cfg *config) {
+		cfg.catchAllCollapse = true
+	}
+}
+
+// WithPathRules sets the rules labeling the requests that do not match any route, such as proxied paths.
+// The rules are matched in order against the request path, the first matching one giving the addr label value,
+// and requests not matching any of them are recorded with the label set by WithUnmatchedPathLabel.
+func WithPathRules(rules []PathRule) Option {
+	return func(cfg *config) {
+		cfg.pathRules = append(cfg.pathRules, rules...)
+	}
+}
+
+// WithTLSLabel adds the tls label to the request metrics, telling whether the request was received over TLS.
+func WithTLSLabel() Option {
+	return func(cfg *config) {
+		cfg.tlsLabel = true
+	}
+}
+
+// WithUnmatchedPathLabel sets the addr label value of the requests that do not match any route nor path rule.
+// An empty label keeps UnmatchedPath.
+func WithUnmatchedPathLabel(label string) Option {
+	return func(cfg *config) {
+		if label != "" {
+			cfg.unmatchedPath = label
+		}
+	}
+}
+
+// WithUserAgentClassifier adds the ua_class label to the request metrics, set to the class the classifier gives
+// the user agent of the request (e.g. bot or browser). The classifier must return a small, bounded set of classes.
+func WithUserAgentClassifier(classifier func(userAgent string) string) Option {
+	return func(cfg *config) {
+		cfg.userAgentClassifier = classifier
+	}
+}
+
+// WithDependencyStatusChangeHook sets the hook called when a check records a status other than the one of the previous check,
+// e.g. to log or notify that a dependency went DOWN. The first check of a dependency does not call it.
+// The hook is called from a single goroutine, in the order the transitions were recorded, so it never blocks the checks.
+// Transitions are queued while the hook runs, and dropped once the queue is full. Shutdown waits for the running hook to return.
+func WithDependencyStatusChangeHook(hook func(name string, from, to DependencyStatus)) Option {
+	return func(cfg *config) {
+		cfg.statusChangeHook = hook
+	}
+}
+
+// WithTimeToFirstByte observes the time from the start of the request to the first write of its response
+// in the gin_request_ttfb_seconds histogram, which is only registered when this option is set.
+// It is the meaningful latency of streamed responses, whose total duration depends on the client reading them.
+func WithTimeToFirstByte() Option {
+	return func(cfg *config) {
+		cfg.timeToFirstByte = true
+	}
+}
@@ -0,0 +1,165 @@
+package gin_monitor
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewConfig(t *testing.T) {
+	cfg := newConfig()
+	if cfg.errorMessageKey != DefaultErrorMessageKey ||
+		!reflect.DeepEqual(cfg.buckets, DefaultBuckets) ||
+		!reflect.DeepEqual(cfg.sizeBuckets, DefaultSizeBuckets) ||
+		!reflect.DeepEqual(cfg.dependencyCheckBuckets, DefaultDependencyCheckBuckets) ||
+		cfg.namespace != "" ||
+		cfg.subsystem != "" ||
+		cfg.constLabels != nil ||
+		cfg.registerer != prometheus.DefaultRegisterer {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+
+	registry := prometheus.NewRegistry()
+	tests := []struct {
+		name string
+		opts []Option
+		want func(cfg *config)
+	}{
+		{
+			name: "partial options",
+			opts: []Option{WithNamespace("myteam")},
+			want: func(cfg *config) {
+				cfg.namespace = "myteam"
+			},
+		},
+		{
+			name: "all options",
+			opts: []Option{
+				WithErrorMessageKey("x-error"),
+				WithBuckets([]float64{1, 2}),
+				WithSizeBuckets([]float64{3, 4}),
+				WithDependencyCheckBuckets([]float64{5, 6}),
+				WithNamespace("myteam"),
+				WithSubsystem("api"),
+				WithConstLabels(prometheus.Labels{"env": "prod"}),
+				WithRegistry(registry),
+			},
+			want: func(cfg *config) {
+				cfg.errorMessageKey = "x-error"
+				cfg.buckets = []float64{1, 2}
+				cfg.sizeBuckets = []float64{3, 4}
+				cfg.dependencyCheckBuckets = []float64{5, 6}
+				cfg.namespace = "myteam"
+				cfg.subsystem = "api"
+				cfg.constLabels = prometheus.Labels{"env": "prod"}
+				cfg.registerer = registry
+			},
+		},
+		{
+			name: "empty values keep defaults",
+			opts: []Option{WithErrorMessageKey(" "), WithBuckets(nil), WithSizeBuckets(nil), WithDependencyCheckBuckets(nil), WithRegistry(nil)},
+			want: func(*config) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := newConfig()
+			tt.want(&want)
+			if got := newConfig(tt.opts...); !reflect.DeepEqual(got, want) {
+				t.Errorf("newConfig() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewWithNamespaceAndSubsystem(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "no prefix",
+			want: []string{"application_info", "dependency_up", "gin_dependency_up", "gin_in_flight_requests", "gin_requests_total", "request_seconds"},
+		},
+		{
+			name: "namespace",
+			opts: []Option{WithNamespace("myteam")},
+			want: []string{"myteam_application_info", "myteam_gin_dependency_up", "myteam_requests_total", "myteam_request_seconds"},
+		},
+		{
+			name: "subsystem",
+			opts: []Option{WithSubsystem("api")},
+			want: []string{"api_application_info", "gin_api_requests_total", "api_request_seconds"},
+		},
+		{
+			name: "namespace and subsystem",
+			opts: []Option{WithNamespace("myteam"), WithSubsystem("api")},
+			want: []string{
+				"myteam_api_application_info", "myteam_api_dependency_up", "myteam_api_gin_dependency_up",
+				"myteam_api_in_flight_requests", "myteam_api_requests_total", "myteam_api_request_seconds",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, registry := newTestMonitor(t, tt.opts...)
+			setDependencyStatus(t, monitor, "fake-dependency", UP)
+			r := gin.New()
+			r.Use(monitor.Prometheus())
+			r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+			serve(r, http.MethodGet, "/")
+
+			for _, name := range tt.want {
+				if findFamily(t, registry, name) == nil {
+					t.Errorf("expected %s to be gathered", name)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLegacy(t *testing.T) {
+	registerer := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+	defer func() { prometheus.DefaultRegisterer = registerer }()
+
+	monitor, err := NewLegacy("v1.0.0", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if monitor.errorMessageKey != DefaultErrorMessageKey {
+		t.Errorf("expected default error message key, got %q", monitor.errorMessageKey)
+	}
+}
+
+func TestNewWithConstLabels(t *testing.T) {
+	monitor, registry := newTestMonitor(t, WithConstLabels(prometheus.Labels{"region": "br-south", "env": "prod"}))
+	setDependencyStatus(t, monitor, "fake-dependency", DOWN)
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	serve(r, http.MethodGet, "/")
+
+	for _, name := range []string{"request_seconds", "dependency_up"} {
+		family := findFamily(t, registry, name)
+		if family == nil {
+			t.Fatalf("expected %s to be gathered", name)
+		}
+		if got := labelValues(family, "region"); !reflect.DeepEqual(got, []string{"br-south"}) {
+			t.Errorf("%s: expected region label br-south, got %v", name, got)
+		}
+		if got := labelValues(family, "env"); !reflect.DeepEqual(got, []string{"prod"}) {
+			t.Errorf("%s: expected env label prod, got %v", name, got)
+		}
+		if got := labelValues(family, "name"); name == "dependency_up" && !reflect.DeepEqual(got, []string{"fake-dependency"}) {
+			t.Errorf("%s: expected the dynamic name label alongside the constant ones, got %v", name, got)
+		}
+	}
+}
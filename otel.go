@@ -0,0 +1,53 @@
+package gin_monitor
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// instrumentationName identifies the meter the OpenTelemetry instruments are created with
+const instrumentationName = "github.com/bancodobrasil/gin-monitor"
+
+// newOtelInstruments creates the OpenTelemetry instruments mirroring the request metrics from the meter provider
+func (m *Monitor) newOtelInstruments() error {
+	meter := m.meterProvider.Meter(instrumentationName)
+
+	requests, err := meter.Int64Counter("gin.requests",
+		metric.WithDescription("Counts the HTTP requests."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return fmt.Errorf("failed to create the OpenTelemetry request counter: %w", err)
+	}
+
+	duration, err := meter.Float64Histogram("gin.request.duration",
+		metric.WithDescription("Duration in seconds of HTTP requests."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return fmt.Errorf("failed to create the OpenTelemetry request duration histogram: %w", err)
+	}
+
+	m.otelRequests, m.otelDuration = requests, duration
+	return nil
+}
+
+// collectOtel records the request in the OpenTelemetry instruments, with the request labels as attributes
+func (m *Monitor) collectOtel(c *gin.Context, labels []string, durationSeconds float64, observeDuration bool) {
+	if m.otelRequests == nil {
+		return
+	}
+
+	names := m.requestLabelNames()
+	attributes := make([]attribute.KeyValue, len(names))
+	for i, name := range names {
+		attributes[i] = attribute.String(name, labels[i])
+	}
+
+	ctx := c.Request.Context()
+	m.otelRequests.Add(ctx, 1, metric.WithAttributes(attributes...))
+	if observeDuration {
+		m.otelDuration.Record(ctx, durationSeconds, metric.WithAttributes(attributes...))
+	}
+}
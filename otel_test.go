@@ -0,0 +1,87 @@
+package gin_monitor
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectOtelMetrics returns the metrics recorded by the reader, by name
+func collectOtelMetrics(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Metrics{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func TestWithMeterProvider(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	monitor, _ := newTestMonitor(t, WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	serve(r, http.MethodGet, "/users/1")
+	serve(r, http.MethodGet, "/users/2")
+	serve(r, http.MethodGet, "/fail")
+
+	metrics := collectOtelMetrics(t, reader)
+
+	requests, ok := metrics["gin.requests"].Data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("expected gin.requests to be an int64 sum, got %T", metrics["gin.requests"].Data)
+	}
+	counts := map[string]int64{}
+	for _, point := range requests.DataPoints {
+		addr, _ := point.Attributes.Value(attribute.Key("addr"))
+		status, _ := point.Attributes.Value(attribute.Key("status"))
+		counts[addr.AsString()+" "+status.AsString()] = point.Value
+	}
+	if len(counts) != 2 || counts["/users/:id 200"] != 2 || counts["/fail 500"] != 1 {
+		t.Errorf("expected 2 requests to /users/:id and 1 to /fail, got %v", counts)
+	}
+
+	duration, ok := metrics["gin.request.duration"].Data.(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("expected gin.request.duration to be a float64 histogram, got %T", metrics["gin.request.duration"].Data)
+	}
+	var observations uint64
+	for _, point := range duration.DataPoints {
+		if got := point.Attributes.Len(); got != len(monitor.requestLabelNames()) {
+			t.Errorf("expected every request label as an attribute, got %d attributes", got)
+		}
+		observations += point.Count
+	}
+	if observations != 3 {
+		t.Errorf("expected 3 durations to be recorded, got %d", observations)
+	}
+}
+
+func TestWithoutMeterProvider(t *testing.T) {
+	monitor, _ := newTestMonitor(t)
+	if monitor.otelRequests != nil || monitor.otelDuration != nil {
+		t.Error("expected no OpenTelemetry instruments without a meter provider")
+	}
+
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	if w := serve(r, http.MethodGet, "/ping"); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
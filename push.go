@@ -0,0 +1,18 @@
+package gin_monitor
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushTo pushes every metric of the registry the monitor was registered with to the Pushgateway at the url,
+// grouped under the job name, replacing the metrics previously pushed for that job.
+// It is meant for short-lived jobs that do not live long enough to be scraped.
+func (m *Monitor) PushTo(url, jobName string) error {
+	gatherer := m.Registry()
+	if gatherer == nil {
+		return errors.New("the registerer given to WithRegistry is not a prometheus.Gatherer")
+	}
+	return push.New(url, jobName).Gatherer(gatherer).Push()
+}
@@ -0,0 +1,70 @@
+package gin_monitor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestPushTo(t *testing.T) {
+	var method, path string
+	var families []string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var family dto.MetricFamily
+			if err := decoder.Decode(&family); err != nil {
+				if err != io.EOF {
+					t.Errorf("failed to decode the pushed metrics: %v", err)
+				}
+				break
+			}
+			families = append(families, family.GetName())
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	monitor, _ := newTestMonitor(t)
+	r := gin.New()
+	r.Use(monitor.Prometheus())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	serve(r, http.MethodGet, "/ping")
+
+	if err := monitor.PushTo(gateway.URL, "batch"); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPut || path != "/metrics/job/batch" {
+		t.Errorf("expected PUT /metrics/job/batch, got %s %s", method, path)
+	}
+	sort.Strings(families)
+	for _, name := range []string{"application_info", "gin_build_info", "request_seconds"} {
+		if i := sort.SearchStrings(families, name); i == len(families) || families[i] != name {
+			t.Errorf("expected %s to be pushed, got %v", name, families)
+		}
+	}
+}
+
+// registererOnly hides the Gatherer methods of the registry it wraps
+type registererOnly struct {
+	prometheus.Registerer
+}
+
+func TestPushToWithoutGatherer(t *testing.T) {
+	monitor, err := New("v1.0.0", WithRegistry(registererOnly{prometheus.NewRegistry()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := monitor.PushTo("http://localhost", "batch"); err == nil {
+		t.Error("expected an error pushing without a gatherer")
+	}
+}
@@ -3,8 +3,11 @@ package gin_monitor
 import (
 	"net/http"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 // workaround to get status code on middleware
@@ -49,3 +52,46 @@ func (r *ResponseWriter) WriteHeader(code int) {
 func (r *ResponseWriter) Count() uint64 {
 	return atomic.LoadUint64(&r.count)
 }
+
+// firstWriteRecorder records when the handlers first send the header or the body of the response.
+// WriteHeader is not recorded, since gin only stores the status until the header is written or flushed.
+type firstWriteRecorder struct {
+	gin.ResponseWriter
+	mutex      sync.Mutex
+	firstWrite time.Time
+}
+
+func (w *firstWriteRecorder) record() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.firstWrite.IsZero() {
+		w.firstWrite = time.Now()
+	}
+}
+
+// at returns when the response was first written, or the zero time if it was not
+func (w *firstWriteRecorder) at() time.Time {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.firstWrite
+}
+
+func (w *firstWriteRecorder) WriteHeaderNow() {
+	w.record()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *firstWriteRecorder) Write(b []byte) (int, error) {
+	w.record()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *firstWriteRecorder) WriteString(s string) (int, error) {
+	w.record()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *firstWriteRecorder) Flush() {
+	w.record()
+	w.ResponseWriter.Flush()
+}
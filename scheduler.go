@@ -0,0 +1,189 @@
+package gin_monitor
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// checkScheduler runs the checks of every dependency sharing the same checking period from a single goroutine,
+// staggering them over the period so they do not fire simultaneously. Each check runs in goroutines of its own
+// while it lasts, so a slow checker does not delay the others, and only the scheduler goroutine is left between checks.
+// Its checks are guarded by the dependencies mutex of the Monitor.
+type checkScheduler struct {
+	period time.Duration
+	start  time.Time
+	checks []*scheduledCheck
+	// added counts the checks ever scheduled, giving the slot of the next one
+	added int
+	wake  chan struct{}
+}
+
+// scheduledCheck is the state of a dependency checker within its scheduler
+type scheduledCheck struct {
+	dependency *dependency
+	checker    ContextDependencyChecker
+	cfg        checkerConfig
+	schedule   *schedule
+	due        time.Time
+	running    bool
+}
+
+// wakeUp makes the scheduler reconsider its checks, without blocking
+func (s *checkScheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// staggerOffset spreads the nth check of a period over it, keeping the offsets apart however many checks there are
+func staggerOffset(n int, period time.Duration) time.Duration {
+	_, fraction := math.Modf(float64(n) * (math.Sqrt(5) - 1) / 2)
+	return time.Duration(fraction * float64(period))
+}
+
+// scheduleChecks adds the checker to the scheduler of its checking period, starting the scheduler if there is none.
+// The first check runs right away, so the status is known shortly after the checker is added, and the following ones
+// run on the slot the check was given within the period. It must be called with the dependencies mutex held.
+func (m *Monitor) scheduleChecks(d *dependency, checker ContextDependencyChecker, checkingPeriod time.Duration, cfg checkerConfig) {
+	s, ok := m.schedulers[checkingPeriod]
+	if !ok {
+		s = &checkScheduler{period: checkingPeriod, start: time.Now(), wake: make(chan struct{}, 1)}
+		m.schedulers[checkingPeriod] = s
+		m.checkers.Add(1)
+		go m.runScheduler(s)
+	}
+
+	now := time.Now()
+	slot := s.start.Add(staggerOffset(s.added, checkingPeriod))
+	s.added++
+	s.checks = append(s.checks, &scheduledCheck{
+		dependency: d,
+		checker:    checker,
+		cfg:        cfg,
+		schedule:   &schedule{period: checkingPeriod, jitter: m.checkJitter, next: slot},
+		due:        now,
+	})
+	d.scheduler = s
+	m.checkersActive.Inc()
+	s.wakeUp()
+}
+
+// runScheduler starts the due checks of the scheduler until it has none left
+func (m *Monitor) runScheduler(s *checkScheduler) {
+	defer m.checkers.Done()
+
+	timer := time.NewTimer(s.period)
+	defer timer.Stop()
+	shutdown := m.ctx.Done()
+	for {
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-shutdown:
+			// the checks still running wake the scheduler once they return
+			shutdown = nil
+		}
+
+		wait, ok := m.dispatchChecks(s, time.Now())
+		if !ok {
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// dispatchChecks drops the removed checks, starts the due ones and returns how long until the next one is due.
+// It reports false once the scheduler has no checks left, removing it from the Monitor.
+func (m *Monitor) dispatchChecks(s *checkScheduler, now time.Time) (time.Duration, bool) {
+	m.dependenciesMutex.Lock()
+	defer m.dependenciesMutex.Unlock()
+
+	wait := s.period
+	checks := s.checks[:0]
+	for _, check := range s.checks {
+		if check.dependency.ctx.Err() != nil && !check.running {
+			m.checkersActive.Dec()
+			close(check.dependency.done)
+			continue
+		}
+		checks = append(checks, check)
+
+		if check.running || check.dependency.ctx.Err() != nil {
+			continue
+		}
+		if !now.Before(check.due) {
+			check.running = true
+			m.checkers.Add(1)
+			go m.runScheduledCheck(s, check)
+			continue
+		}
+		if until := check.due.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	s.checks = checks
+
+	if len(s.checks) == 0 {
+		delete(m.schedulers, s.period)
+		return 0, false
+	}
+	return wait, true
+}
+
+// runScheduledCheck runs the check and collects its metrics, then computes when it is due again
+func (m *Monitor) runScheduledCheck(s *checkScheduler, check *scheduledCheck) {
+	defer m.checkers.Done()
+
+	d := check.dependency
+	started := time.Now()
+	status := runCheckWithRetries(d.ctx, check.checker, check.cfg)
+	if d.ctx.Err() == nil {
+		m.recordCheck(d, status, time.Since(started))
+	}
+
+	m.dependenciesMutex.Lock()
+	now := time.Now()
+	check.running = false
+	check.due = now.Add(check.schedule.advance(now))
+	m.dependenciesMutex.Unlock()
+	s.wakeUp()
+}
+
+// schedule computes when a checker runs, keeping a fixed rate and dropping missed checks like time.Ticker
+type schedule struct {
+	period time.Duration
+	jitter float64
+	next   time.Time
+}
+
+// advance moves the next check past now and returns how long until it
+func (s *schedule) advance(now time.Time) time.Duration {
+	// skip the periods missed at once, as the schedule may start long before the checker was added
+	if behind := now.Sub(s.next); behind > s.period {
+		s.next = s.next.Add(behind / s.period * s.period)
+	}
+	for !s.next.After(now) {
+		s.next = s.next.Add(jitterInterval(s.period, s.jitter))
+	}
+	return s.next.Sub(now)
+}
+
+// jitterInterval randomizes the interval by up to ±fraction of it
+func jitterInterval(interval time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return interval
+	}
+	jittered := interval + time.Duration((rand.Float64()*2-1)*fraction*float64(interval))
+	if jittered < time.Millisecond {
+		return time.Millisecond
+	}
+	return jittered
+}
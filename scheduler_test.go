@@ -0,0 +1,91 @@
+package gin_monitor
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingChecker counts how many times it was checked
+type countingChecker struct {
+	name  string
+	calls int32
+}
+
+func (c *countingChecker) GetDependencyName() string { return c.name }
+
+func (c *countingChecker) Check() DependencyStatus {
+	atomic.AddInt32(&c.calls, 1)
+	return UP
+}
+
+func TestStaggerOffset(t *testing.T) {
+	const period, checks = time.Second, 12
+
+	offsets := make([]time.Duration, checks)
+	for i := range offsets {
+		offsets[i] = staggerOffset(i, period)
+		if offsets[i] < 0 || offsets[i] >= period {
+			t.Fatalf("offset %d = %v, out of the period", i, offsets[i])
+		}
+	}
+
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for i := 1; i < checks; i++ {
+		if gap := offsets[i] - offsets[i-1]; gap < period/(4*checks) {
+			t.Errorf("offsets %v and %v are too close to stagger the checks", offsets[i-1], offsets[i])
+		}
+	}
+}
+
+func TestSharedScheduler(t *testing.T) {
+	before := runtime.NumGoroutine()
+	monitor, _ := newTestMonitor(t)
+
+	const checkers = 12
+	var all []*countingChecker
+	for i := 0; i < checkers; i++ {
+		checker := &countingChecker{name: fmt.Sprintf("dependency-%d", i)}
+		all = append(all, checker)
+		if err := monitor.AddDependencyChecker(checker, 50*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	monitor.AddDependencyChecker(&countingChecker{name: "other-period"}, time.Hour)
+
+	waitFor(t, "every checker to be checked several times", func() bool {
+		for _, checker := range all {
+			if atomic.LoadInt32(&checker.calls) < 3 {
+				return false
+			}
+		}
+		return true
+	})
+	for name, status := range monitor.DependencyStatuses() {
+		if status != UP {
+			t.Errorf("expected %s to be UP, got %v", name, status)
+		}
+	}
+
+	monitor.dependenciesMutex.RLock()
+	schedulers := len(monitor.schedulers)
+	monitor.dependenciesMutex.RUnlock()
+	if schedulers != 2 {
+		t.Errorf("expected one scheduler per checking period, got %d", schedulers)
+	}
+	// the checks run in short-lived goroutines, leaving one goroutine per checking period between them
+	waitFor(t, "the idle checkers to share one goroutine per checking period", func() bool {
+		return runtime.NumGoroutine()-before <= schedulers
+	})
+
+	// the scheduler stops along with its last checker
+	monitor.RemoveDependencyChecker("other-period")
+	waitFor(t, "the emptied scheduler to stop", func() bool {
+		monitor.dependenciesMutex.RLock()
+		defer monitor.dependenciesMutex.RUnlock()
+		return len(monitor.schedulers) == 1
+	})
+}